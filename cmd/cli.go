@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/user/footballsim/database"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// defaultPredictRuns is the number of simulated seasons used by "predict" without -runs
+const defaultPredictRuns = 1000
+
+// printUsage prints the list of commands
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `Usage: footballsim <command> [flags]
+
+Commands:
+  serve [-no-seed]                      Migrate the database, load the sample league and start the HTTP server (default)
+  migrate                               Create or update the database schema without touching any data
+  seed                                  Reset the default tenant to the sample league
+  simulate week N [-tenant S] [-json]   Simulate the matches of week N
+  simulate all [-tenant S] [-json]      Simulate all remaining matches
+  table [-tenant S] [-json]             Print the current league table
+  predict [-runs N] [-timeout D] [-tenant S] [-json]
+                                        Simulate the rest of the season N times and print the final table distribution
+  reset [-tenant S]                     Clear all results and move the league back to week 1
+  experiment [-seasons N] [-workers N] [-home-advantage X] [-tenant S] [-json]
+                                        Simulate N complete seasons from week 1 without changing the league
+  import teams|fixtures FILE [-dry-run] [-tenant S] [-format csv|json]
+                                        Import teams or fixtures from a file
+
+Database settings come from DATABASE_URL or the DB_* environment variables.
+Logs go to stderr; command output goes to stdout.
+`)
+}
+
+// tenantRepos holds the repositories of one tenant
+type tenantRepos struct {
+	Teams   *database.SQLTeamRepository
+	Matches *database.SQLMatchRepository
+	League  *database.SQLLeagueRepository
+	Lock    *database.SQLLeagueLock
+	Tx      *database.SQLTransactor
+}
+
+// openTenant connects to the database and returns the repositories of the tenant with the given slug
+func openTenant(ctx context.Context, command, slug string) (*sql.DB, *tenantRepos) {
+	db := connectDatabase()
+
+	tenant, err := database.NewSQLTenantRepository(db).GetBySlug(ctx, slug)
+	if err != nil {
+		db.Close()
+		exitWithError(command, fmt.Errorf("unknown tenant %q: %v", slug, err))
+	}
+
+	return db, &tenantRepos{
+		Teams:   database.NewSQLTeamRepository(db, tenant.ID),
+		Matches: database.NewSQLMatchRepository(db, tenant.ID),
+		League:  database.NewSQLLeagueRepository(db, tenant.ID),
+		Lock:    database.NewSQLLeagueLock(db, tenant.ID),
+		Tx:      database.NewSQLTransactor(db),
+	}
+}
+
+// runMigrate implements "migrate"
+func runMigrate(ctx context.Context, args []string) {
+	parseArgs(flag.NewFlagSet("migrate", flag.ExitOnError), args)
+
+	db := connectDatabase()
+	defer db.Close()
+
+	if err := database.MigrateDB(ctx, db); err != nil {
+		exitWithError("migrate", err)
+	}
+}
+
+// runSeed implements "seed"
+func runSeed(ctx context.Context, args []string) {
+	parseArgs(flag.NewFlagSet("seed", flag.ExitOnError), args)
+
+	db := connectDatabase()
+	defer db.Close()
+
+	if err := database.SeedDB(ctx, db); err != nil {
+		exitWithError("seed", err)
+	}
+}
+
+// runSimulate implements "simulate week N" and "simulate all"
+func runSimulate(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	tenantSlug := flags.String("tenant", models.DefaultTenantSlug, "tenant whose league is simulated")
+	asJSON := flags.Bool("json", false, "print JSON instead of a text table")
+	positional := parseArgs(flags, args)
+
+	week := 0
+	switch {
+	case len(positional) == 1 && positional[0] == "all":
+	case len(positional) == 2 && positional[0] == "week":
+		var err error
+		if week, err = strconv.Atoi(positional[1]); err != nil || week < 1 {
+			exitWithUsage("simulate", fmt.Sprintf("invalid week %q", positional[1]))
+		}
+	default:
+		exitWithUsage("simulate", "expected \"week N\" or \"all\"")
+	}
+
+	db, repos := openTenant(ctx, "simulate", *tenantSlug)
+	defer db.Close()
+
+	// Refuse to run alongside a simulation, reset or result edit of the same league in the server
+	unlock, err := repos.Lock.TryLock(ctx)
+	if err != nil {
+		exitWithError("simulate", err)
+	}
+	defer unlock()
+
+	simulator := services.NewMatchSimulator(repos.Teams, repos.Matches, repos.League, repos.Tx)
+
+	var matches []*models.Match
+	if week > 0 {
+		matches, err = simulator.SimulateWeek(ctx, week)
+	} else {
+		matches, err = simulator.SimulateRemaining(ctx)
+	}
+	if err != nil {
+		exitWithError("simulate", err)
+	}
+
+	if *asJSON {
+		printJSON(matches)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WEEK\tHOME\t\tAWAY")
+	for _, match := range matches {
+		fmt.Fprintf(w, "%d\t%s\t%d - %d\t%s\n", match.Week, match.HomeTeamName, match.HomeTeamGoals, match.AwayTeamGoals, match.AwayTeamName)
+	}
+	w.Flush()
+}
+
+// runTable implements "table"
+func runTable(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("table", flag.ExitOnError)
+	tenantSlug := flags.String("tenant", models.DefaultTenantSlug, "tenant whose table is printed")
+	asJSON := flags.Bool("json", false, "print JSON instead of a text table")
+	parseArgs(flags, args)
+
+	db, repos := openTenant(ctx, "table", *tenantSlug)
+	defer db.Close()
+
+	table, err := services.NewLeagueService(repos.Teams, repos.Matches, repos.League, repos.Tx).Table(ctx)
+	if err != nil {
+		exitWithError("table", err)
+	}
+
+	if *asJSON {
+		printJSON(table)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "POS\tTEAM\tP\tW\tD\tL\tGF\tGA\tGD\tPTS\t")
+	for i, stats := range table {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%+d\t%d\t\n", i+1, stats.TeamName, stats.Played, stats.Won, stats.Drawn, stats.Lost,
+			stats.GoalsFor, stats.GoalsAgainst, stats.GoalDifference, stats.Points)
+	}
+	w.Flush()
+}
+
+// runPredict implements "predict [-runs N]". It ignores the league's prediction rule, which only applies to the API.
+func runPredict(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("predict", flag.ExitOnError)
+	runs := flags.Int("runs", defaultPredictRuns, "number of simulated seasons")
+	timeout := flags.Duration("timeout", 0, "stop after this long and print the runs finished so far (default: no limit)")
+	tenantSlug := flags.String("tenant", models.DefaultTenantSlug, "tenant whose league is predicted")
+	asJSON := flags.Bool("json", false, "print JSON instead of a text table")
+	parseArgs(flags, args)
+
+	if *runs < 1 {
+		exitWithUsage("predict", "-runs must be at least 1")
+	}
+
+	db, repos := openTenant(ctx, "predict", *tenantSlug)
+	defer db.Close()
+
+	simulator := services.NewMatchSimulator(repos.Teams, repos.Matches, repos.League, repos.Tx)
+	predictor := services.NewTablePredictor(repos.Teams, repos.Matches, repos.League, simulator)
+
+	// Ctrl-C or the timeout stop the simulation early with a partial result
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	distribution, err := predictor.PredictDistribution(ctx, nil, *runs)
+	if err != nil {
+		exitWithError("predict", err)
+	}
+
+	if *asJSON {
+		printJSON(distribution)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "POS\tTEAM\tAVG PTS\tPTS 90%\tAVG GD\tEXP POS\tPOS 90%\tTITLE\t")
+	for i, team := range distribution.Teams {
+		fmt.Fprintf(w, "%d\t%s\t%.1f\t%d-%d\t%+.1f\t%.2f\t%d-%d\t%.1f%%\t\n", i+1, team.TeamName, team.AveragePoints,
+			team.PointsInterval[0], team.PointsInterval[1], team.AverageGoalDifference, team.ExpectedPosition,
+			team.PositionInterval[0], team.PositionInterval[1], team.TitleProbability*100)
+	}
+	w.Flush()
+	if distribution.Partial {
+		fmt.Printf("%d of %d simulated seasons (stopped early), ", distribution.Runs, distribution.RequestedRuns)
+	} else {
+		fmt.Printf("%d simulated seasons, ", distribution.Runs)
+	}
+	fmt.Printf("probabilities within ±%.1f%%\n", distribution.ErrorBound*100)
+}
+
+// runReset implements "reset"
+func runReset(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("reset", flag.ExitOnError)
+	tenantSlug := flags.String("tenant", models.DefaultTenantSlug, "tenant whose league is reset")
+	parseArgs(flags, args)
+
+	db, repos := openTenant(ctx, "reset", *tenantSlug)
+	defer db.Close()
+
+	unlock, err := repos.Lock.Lock(ctx)
+	if err != nil {
+		exitWithError("reset", err)
+	}
+	defer unlock()
+
+	if err := services.NewLeagueService(repos.Teams, repos.Matches, repos.League, repos.Tx).Reset(ctx); err != nil {
+		exitWithError("reset", err)
+	}
+	fmt.Println("League reset successfully")
+}
+
+// runExperiment implements "experiment [-seasons N] [-workers N] [-home-advantage X]"
+func runExperiment(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("experiment", flag.ExitOnError)
+	config := new(models.ExperimentConfig)
+	flags.IntVar(&config.Seasons, "seasons", 0, "number of complete seasons to simulate (default 1000)")
+	flags.IntVar(&config.Workers, "workers", 0, "number of worker goroutines (default: number of CPUs)")
+	homeAdvantage := flags.Float64("home-advantage", -1, "chance added to each home scoring chance (default: the simulator's)")
+	tenantSlug := flags.String("tenant", models.DefaultTenantSlug, "tenant whose league is simulated")
+	asJSON := flags.Bool("json", false, "print JSON instead of a text report")
+	parseArgs(flags, args)
+
+	if *homeAdvantage >= 0 {
+		config.HomeAdvantage = homeAdvantage
+	}
+
+	db, repos := openTenant(ctx, "experiment", *tenantSlug)
+	defer db.Close()
+
+	simulator := services.NewMatchSimulator(repos.Teams, repos.Matches, repos.League, repos.Tx)
+	report, err := services.NewExperimentRunner(repos.Teams, repos.Matches, simulator).Run(ctx, config)
+	if err != nil {
+		exitWithError("experiment", err)
+	}
+
+	if *asJSON {
+		printJSON(report)
+		return
+	}
+
+	fmt.Printf("%d seasons on %d workers in %dms, home advantage %.2f\n", report.Seasons, report.Workers, report.DurationMillis, report.HomeAdvantage)
+	fmt.Printf("Strongest team title rate  %.1f%%\n", report.StrongestTeamTitleRate*100)
+	fmt.Printf("Average title margin       %.2f points\n", report.AverageTitleMargin)
+	fmt.Printf("Average points spread      %.2f points\n", report.AveragePointsSpread)
+	fmt.Printf("Home / draw / away         %.1f%% / %.1f%% / %.1f%%\n", report.HomeWinRate*100, report.DrawRate*100, report.AwayWinRate*100)
+	fmt.Printf("Goals per match            %.2f\n\n", report.AverageGoalsPerMatch)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "TEAM\tAVG PTS\tTITLE\t")
+	for position := range report.Teams {
+		fmt.Fprintf(w, "P%d\t", position+1)
+	}
+	fmt.Fprintln(w)
+	for _, team := range report.Teams {
+		fmt.Fprintf(w, "%s\t%.1f\t%.1f%%\t", team.TeamName, team.AveragePoints, team.TitleProbability*100)
+		for _, probability := range team.PositionProbabilities {
+			fmt.Fprintf(w, "%.1f%%\t", probability*100)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+// parseArgs parses flags that may appear before, between or after the positional arguments and returns the positional arguments
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	positional := make([]string, 0)
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// printJSON writes value to stdout as indented JSON
+func printJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		exitWithError("json", err)
+	}
+}
+
+// exitWithUsage reports a usage error and exits with status 2
+func exitWithUsage(command, message string) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n\n", command, message)
+	printUsage(os.Stderr)
+	os.Exit(2)
+}
+
+// exitWithError reports a failed command and exits with status 1
+func exitWithError(command string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+	os.Exit(1)
+}
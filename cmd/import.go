@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// runImport implements "import teams|fixtures FILE [-dry-run] [-tenant SLUG] [-format csv|json]"
+func runImport(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the file and report errors without importing")
+	tenantSlug := flags.String("tenant", models.DefaultTenantSlug, "tenant to import into")
+	format := flags.String("format", "", "csv or json (default: from the file extension)")
+	positional := parseArgs(flags, args)
+
+	if len(positional) != 2 || (positional[0] != models.ImportKindTeams && positional[0] != models.ImportKindFixtures) {
+		exitWithUsage("import", "expected \"teams FILE\" or \"fixtures FILE\"")
+	}
+	kind, path := positional[0], positional[1]
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		exitWithError("import", err)
+	}
+	defer file.Close()
+
+	db, repos := openTenant(ctx, "import", *tenantSlug)
+	defer db.Close()
+
+	importer := services.NewImporter(repos.Teams, repos.Matches, repos.League, repos.Tx, repos.Lock)
+
+	var report *models.ImportReport
+	if kind == models.ImportKindTeams {
+		report, err = importer.ImportTeams(ctx, *format, file, *dryRun)
+	} else {
+		report, err = importer.ImportFixtures(ctx, *format, file, *dryRun)
+	}
+	if err != nil {
+		exitWithError("import", err)
+	}
+
+	for _, importErr := range report.Errors {
+		fmt.Printf("%s:%d: %s\n", path, importErr.Line, importErr.Message)
+	}
+
+	switch {
+	case len(report.Errors) > 0:
+		fmt.Printf("%d of %d %s rows have errors, nothing imported\n", len(report.Errors), report.Rows, kind)
+		os.Exit(1)
+	case report.DryRun:
+		fmt.Printf("%d %s rows are valid (dry run, nothing imported)\n", report.Rows, kind)
+	default:
+		fmt.Printf("Imported %d %s\n", report.Imported, kind)
+	}
+}
@@ -1,77 +1,175 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/user/footballsim/database"
 	"github.com/user/footballsim/handlers"
+	"github.com/user/footballsim/metrics"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/openapi"
 	"github.com/user/footballsim/services"
 )
 
 func main() {
-	// Initialize database connection using standard environment variables
-	var dbConfig *database.DBConfig
-	
-	// Check for DATABASE_URL environment variable
-	if dbURL := os.Getenv("DATABASE_URL"); dbURL != "" {
-		log.Println("Using DATABASE_URL environment variable")
-		dbConfig = &database.DBConfig{
-			ConnectionString: dbURL,
-			UseDirectURL:     true,
-		}
-	} else {
-		// Use individual environment variables or defaults
-		log.Println("Using individual database environment variables")
-		dbConfig = database.NewDBConfig()
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
-	
-	log.Printf("Connecting to database...")
-	db, err := database.ConnectDB(dbConfig)
-	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+
+	if command == "serve" {
+		runServe(args)
+		return
+	}
+
+	// Ctrl-C cancels the database work of the other commands
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch command {
+	case "migrate":
+		runMigrate(ctx, args)
+	case "seed":
+		runSeed(ctx, args)
+	case "simulate":
+		runSimulate(ctx, args)
+	case "table":
+		runTable(ctx, args)
+	case "predict":
+		runPredict(ctx, args)
+	case "reset":
+		runReset(ctx, args)
+	case "experiment":
+		runExperiment(ctx, args)
+	case "import":
+		runImport(ctx, args)
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		printUsage(os.Stderr)
+		os.Exit(2)
 	}
+}
+
+// runServe implements "serve [-no-seed]": it migrates the database, loads the sample league and starts the HTTP server
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	noSeed := flags.Bool("no-seed", false, "keep the default tenant's data instead of loading the sample league")
+	parseArgs(flags, args)
+
+	db := connectDatabase()
 	defer db.Close()
 
 	// Initialize database schema and sample data
-	err = database.InitDB(db)
-	if err != nil {
+	initDB := database.InitDB
+	if *noSeed {
+		initDB = database.MigrateDB
+	}
+	if err := initDB(context.Background(), db); err != nil {
 		log.Fatalf("Error initializing database: %v", err)
 	}
 
-	// Initialize repositories
-	teamRepo := database.NewSQLTeamRepository(db)
-	matchRepo := database.NewSQLMatchRepository(db)
-	leagueRepo := database.NewSQLLeagueRepository(db)
+	// Initialize repositories shared by all tenants
+	apiKeyRepo := database.NewSQLAPIKeyRepository(db)
+	tenantRepo := database.NewSQLTenantRepository(db)
 
-	// Initialize services
-	simulator := services.NewMatchSimulator(teamRepo, matchRepo, leagueRepo)
-	predictor := services.NewTablePredictor(teamRepo, matchRepo, leagueRepo, simulator)
+	// ADMIN_API_KEY is a bootstrap admin key used to issue the first stored API keys
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	if adminKey == "" {
+		log.Println("ADMIN_API_KEY is not set; only stored API keys can use write endpoints")
+	}
+	authService := services.NewAuthService(apiKeyRepo, adminKey)
 
-	// Initialize handlers
-	teamHandler := handlers.NewTeamHandler(teamRepo)
-	matchHandler := handlers.NewMatchHandler(matchRepo, teamRepo, simulator)
-	leagueHandler := handlers.NewLeagueHandler(leagueRepo, teamRepo, matchRepo, predictor)
+	// Initialize handlers shared by all tenants
+	authHandler := handlers.NewAuthHandler(apiKeyRepo, authService)
+	tenantHandler := handlers.NewTenantHandler(tenantRepo)
+
+	// Each tenant gets its own repositories, services and handlers.
+	// TENANT_BASE_DOMAIN enables tenant subdomains such as acme.<TENANT_BASE_DOMAIN>.
+	workspaces := handlers.NewWorkspaceRegistry(tenantRepo, func(tenant *models.Tenant) *handlers.Workspace {
+		return newWorkspace(db, tenant)
+	}, os.Getenv("TENANT_BASE_DOMAIN"))
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
-		AppName: "Football League Simulator",
+		AppName:      "Football League Simulator",
+		ErrorHandler: handlers.ErrorHandler,
 	})
 
+	// Health probes are registered before the middleware so they skip request logging
+	healthHandler := handlers.NewHealthHandler(func(ctx context.Context) error {
+		return database.CheckSchema(ctx, db)
+	})
+	app.Get("/healthz", healthHandler.Healthz)
+	app.Get("/readyz", healthHandler.Readyz)
+
+	// Prometheus scrapes /metrics with METRICS_TOKEN as its bearer token; the league weeks and
+	// pool stats are read on each scrape. Without a token the endpoint is not served.
+	if metricsToken := os.Getenv("METRICS_TOKEN"); metricsToken != "" {
+		metrics.Default.OnScrape(func(ctx context.Context) {
+			recordDatabaseMetrics(ctx, db, tenantRepo)
+		})
+		app.Get("/metrics", handlers.NewMetricsHandler(metrics.Default, metricsToken).GetMetrics)
+	} else {
+		log.Println("METRICS_TOKEN is not set; /metrics is disabled")
+	}
+
 	// Add middleware
 	app.Use(logger.New())
+	app.Use(handlers.RequestMetrics())
+
+	// REQUEST_TIMEOUT bounds every request, for example "30s"
+	requestTimeout := handlers.DefaultRequestTimeout
+	if value := os.Getenv("REQUEST_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid REQUEST_TIMEOUT %q", value)
+		}
+		requestTimeout = parsed
+	}
+	// Requests still running when the shutdown drain timeout ends are cancelled with requestsCtx
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	app.Use(handlers.RequestTimeout(requestsCtx, requestTimeout))
 	
-	// Configure CORS to allow requests from any origin
+	// Configure CORS; CORS_ALLOW_ORIGINS takes a comma separated list of origins
+	allowOrigins := os.Getenv("CORS_ALLOW_ORIGINS")
+	if allowOrigins == "" {
+		allowOrigins = "*"
+	}
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept",
+		AllowOrigins: allowOrigins,
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-API-Key, " + models.IdempotencyKeyHeader + ", " + handlers.TenantHeader,
 	}))
 
+	// IDEMPOTENCY_WINDOW is how long Idempotency-Key responses are kept for replay, for example "24h"
+	idempotencyWindow := handlers.DefaultIdempotencyWindow
+	if value := os.Getenv("IDEMPOTENCY_WINDOW"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid IDEMPOTENCY_WINDOW %q", value)
+		}
+		idempotencyWindow = parsed
+	}
+	// A request cannot outlive its timeout, so a key still unfinished a minute after that belongs to a request that died
+	idempotencyLease := requestTimeout + time.Minute
+	idempotencyHandler := handlers.NewIdempotencyHandler(database.NewSQLIdempotencyRepository(db), idempotencyWindow, idempotencyLease)
+
 	// Setup routes
-	handlers.SetupRoutes(app, teamHandler, matchHandler, leagueHandler)
+	handlers.SetupRoutes(app, workspaces, authHandler, tenantHandler, handlers.NewOpenAPIHandler(openapi.MustLoad()), idempotencyHandler)
 
 	// Serve static files
 	app.Static("/", "./utils/static")
@@ -87,8 +185,153 @@ func main() {
 		port = "8080" // Default port if not specified
 	}
 
+	// SHUTDOWN_TIMEOUT is how long requests in flight may finish after SIGTERM, for example "20s"
+	shutdownTimeout := defaultShutdownTimeout
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid SHUTDOWN_TIMEOUT %q", value)
+		}
+		shutdownTimeout = parsed
+	}
+
+	// JOB_WORKERS is the number of background jobs this instance runs at once; 0 leaves them to other instances
+	jobWorkers := services.DefaultJobWorkers
+	if value := os.Getenv("JOB_WORKERS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Fatalf("Invalid JOB_WORKERS %q", value)
+		}
+		jobWorkers = parsed
+	}
+	jobQueue := services.NewJobQueue(database.NewSQLJobRepository(db), jobWorkers, func(ctx context.Context, tenantID int) (*services.JobService, error) {
+		workspace, err := workspaces.TenantWorkspace(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		return workspace.Jobs.Service, nil
+	})
+	// Jobs still running at shutdown are put back in the queue for the next start
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsStopped := make(chan struct{})
+	go func() {
+		jobQueue.Run(jobsCtx)
+		close(jobsStopped)
+	}()
+
 	// Start server
 	log.Printf("Server starting on port %s", port)
 	log.Printf("Visit http://localhost:%s to view the application", port)
-	log.Fatal(app.Listen(":" + port))
-} 
\ No newline at end of file
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(":" + port)
+	}()
+
+	// Deploys stop the old instance with SIGTERM; Ctrl+C sends SIGINT
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-listenErr:
+		log.Fatalf("Server stopped: %v", err)
+	case <-signalCtx.Done():
+	}
+	stop()
+
+	log.Printf("Shutting down, waiting up to %s for requests in flight", shutdownTimeout)
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		log.Printf("Error shutting down: %v", err)
+	}
+	cancelRequests()
+	stopJobs()
+	<-jobsStopped
+	log.Println("Server stopped")
+}
+
+// recordDatabaseMetrics sets the connection pool gauges and the current week of each tenant's league
+func recordDatabaseMetrics(ctx context.Context, db *sql.DB, tenantRepo *database.SQLTenantRepository) {
+	stats := db.Stats()
+	metrics.DBOpenConnections.Set(float64(stats.OpenConnections))
+	metrics.DBInUseConnections.Set(float64(stats.InUse))
+	metrics.DBIdleConnections.Set(float64(stats.Idle))
+	metrics.DBMaxOpenConnections.Set(float64(stats.MaxOpenConnections))
+	metrics.DBWaitCount.Set(float64(stats.WaitCount))
+	metrics.DBWaitDuration.Set(stats.WaitDuration.Seconds())
+
+	weeks, err := tenantRepo.CurrentWeeks(ctx)
+	if err != nil {
+		log.Printf("Error reading league weeks for metrics: %v", err)
+		return
+	}
+	metrics.CurrentWeek.Reset()
+	for slug, week := range weeks {
+		metrics.CurrentWeek.Set(float64(week), slug)
+	}
+}
+
+// defaultShutdownTimeout is the drain timeout used when SHUTDOWN_TIMEOUT is not set
+const defaultShutdownTimeout = 20 * time.Second
+
+// connectDatabase connects to the database configured by the environment, exiting on failure
+func connectDatabase() *sql.DB {
+	// Initialize database connection using standard environment variables
+	var dbConfig *database.DBConfig
+
+	// Check for DATABASE_URL environment variable
+	if dbURL := os.Getenv("DATABASE_URL"); dbURL != "" {
+		log.Println("Using DATABASE_URL environment variable")
+		dbConfig = &database.DBConfig{
+			ConnectionString: dbURL,
+			UseDirectURL:     true,
+		}
+	} else {
+		// Use individual environment variables or defaults
+		log.Println("Using individual database environment variables")
+		dbConfig = database.NewDBConfig()
+	}
+
+	log.Printf("Connecting to database...")
+	db, err := database.ConnectDB(dbConfig)
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+
+	return db
+}
+
+// newWorkspace wires up the repositories, services and handlers of a single tenant
+func newWorkspace(db *sql.DB, tenant *models.Tenant) *handlers.Workspace {
+	// Initialize repositories
+	teamRepo := database.NewSQLTeamRepository(db, tenant.ID)
+	matchRepo := database.NewSQLMatchRepository(db, tenant.ID)
+	leagueRepo := database.NewSQLLeagueRepository(db, tenant.ID)
+	scenarioRepo := database.NewSQLScenarioRepository(db, tenant.ID)
+	leagueLock := database.NewSQLLeagueLock(db, tenant.ID)
+	transactor := database.NewSQLTransactor(db)
+
+	// Initialize services
+	simulator := services.NewMatchSimulator(teamRepo, matchRepo, leagueRepo, transactor)
+	predictor := services.NewTablePredictor(teamRepo, matchRepo, leagueRepo, simulator)
+	calibrator := services.NewCalibrator(teamRepo, matchRepo, leagueLock)
+	oddsCalculator := services.NewOddsCalculator(teamRepo, simulator)
+	scenarioService := services.NewScenarioService(scenarioRepo, matchRepo, predictor)
+	outlookAnalyzer := services.NewOutlookAnalyzer(teamRepo, matchRepo)
+	leagueService := services.NewLeagueService(teamRepo, matchRepo, leagueRepo, transactor)
+	importer := services.NewImporter(teamRepo, matchRepo, leagueRepo, transactor, leagueLock)
+	exporter := services.NewExporter(teamRepo, matchRepo, leagueRepo, predictor)
+	experimentRunner := services.NewExperimentRunner(teamRepo, matchRepo, simulator)
+	jobService := services.NewJobService(database.NewSQLJobRepository(db), tenant.ID, matchRepo, simulator, predictor, experimentRunner, leagueLock)
+
+	// Initialize handlers
+	return &handlers.Workspace{
+		Tenant:      tenant,
+		Teams:       handlers.NewTeamHandler(teamRepo, services.NewTeamService(teamRepo, matchRepo, oddsCalculator, leagueLock)),
+		Matches:     handlers.NewMatchHandler(matchRepo, teamRepo, simulator, oddsCalculator, leagueLock, transactor),
+		League:      handlers.NewLeagueHandler(leagueRepo, teamRepo, matchRepo, predictor, outlookAnalyzer, leagueService, leagueLock),
+		Calibration: handlers.NewCalibrationHandler(calibrator),
+		Scenarios:   handlers.NewScenarioHandler(scenarioRepo, scenarioService),
+		Import:      handlers.NewImportHandler(importer),
+		Export:      handlers.NewExportHandler(exporter),
+		Experiments: handlers.NewExperimentHandler(experimentRunner),
+		Jobs:        handlers.NewJobHandler(jobService),
+	}
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/user/footballsim/models"
+)
+
+// SQLAPIKeyRepository implements the APIKeyRepository interface
+type SQLAPIKeyRepository struct {
+	DB *sql.DB
+}
+
+// NewSQLAPIKeyRepository creates a new SQLAPIKeyRepository
+func NewSQLAPIKeyRepository(db *sql.DB) *SQLAPIKeyRepository {
+	return &SQLAPIKeyRepository{
+		DB: db,
+	}
+}
+
+// GetAll returns all API keys of a tenant
+func (r *SQLAPIKeyRepository) GetAll(ctx context.Context, tenantID int) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, tenant_id, name, role, prefix, key_hash, created_at
+		FROM api_keys
+		WHERE tenant_id = $1
+		ORDER BY id ASC`
+
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*models.APIKey, 0)
+	for rows.Next() {
+		key := &models.APIKey{}
+		err := rows.Scan(
+			&key.ID,
+			&key.TenantID,
+			&key.Name,
+			&key.Role,
+			&key.Prefix,
+			&key.KeyHash,
+			&key.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetByHash returns the API key with the given key hash, whichever tenant it belongs to
+func (r *SQLAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := `
+		SELECT id, tenant_id, name, role, prefix, key_hash, created_at
+		FROM api_keys
+		WHERE key_hash = $1`
+
+	key := &models.APIKey{}
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, keyHash).Scan(
+		&key.ID,
+		&key.TenantID,
+		&key.Name,
+		&key.Role,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Create stores a new API key
+func (r *SQLAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (tenant_id, name, role, prefix, key_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	return conn(ctx, r.DB).QueryRowContext(
+		ctx,
+		query,
+		key.TenantID,
+		key.Name,
+		key.Role,
+		key.Prefix,
+		key.KeyHash,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+// Delete revokes an API key of a tenant
+func (r *SQLAPIKeyRepository) Delete(ctx context.Context, tenantID, id int) error {
+	query := `DELETE FROM api_keys WHERE id = $1 AND tenant_id = $2`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, id, tenantID)
+	return err
+}
@@ -1,7 +1,9 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -122,24 +124,67 @@ func getEnv(key, fallback string) string {
 }
 
 // InitDB initializes the database with the schema and sample data
-func InitDB(db *sql.DB) error {
+func InitDB(ctx context.Context, db *sql.DB) error {
+	if err := MigrateDB(ctx, db); err != nil {
+		return err
+	}
+	return SeedDB(ctx, db)
+}
+
+// MigrateDB creates the tables and adds missing columns without touching any data
+func MigrateDB(ctx context.Context, db *sql.DB) error {
 	log.Println("Initializing database schema...")
-	
-	// Read the schema file
-	schemaBytes, err := os.ReadFile("database/sql_schema.sql")
+	return execSQLFile(ctx, db, "database/sql_schema.sql")
+}
+
+// SeedDB resets the default tenant to the sample league. Other tenants are left alone.
+func SeedDB(ctx context.Context, db *sql.DB) error {
+	log.Println("Loading sample data...")
+	return execSQLFile(ctx, db, "database/sql_seed.sql")
+}
+
+// execSQLFile executes the statements of a SQL file
+func execSQLFile(ctx context.Context, db *sql.DB, path string) error {
+	// Read the SQL file
+	sqlBytes, err := os.ReadFile(path)
 	if err != nil {
-		log.Printf("Error reading schema file: %v", err)
+		log.Printf("Error reading %s: %v", path, err)
 		return err
 	}
 
-	log.Println("Executing schema SQL...")
-	// Execute the schema
-	_, err = db.Exec(string(schemaBytes))
+	log.Printf("Executing %s...", path)
+	_, err = db.ExecContext(ctx, string(sqlBytes))
 	if err != nil {
-		log.Printf("Error executing schema SQL: %v", err)
+		log.Printf("Error executing %s: %v", path, err)
 		return err
 	}
 
-	log.Println("Database initialized successfully")
+	log.Printf("Executed %s successfully", path)
 	return nil
-} 
\ No newline at end of file
+}
+
+// SchemaVersion is the version that sql_schema.sql records in the schema_version table
+const SchemaVersion = 5
+
+// ErrSchemaVersion is returned when the database schema is missing or from another version
+var ErrSchemaVersion = errors.New("unexpected schema version")
+
+// CheckSchema pings the database and checks that MigrateDB has brought it to SchemaVersion
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT version FROM schema_version").Scan(&version)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: no version recorded, want %d", ErrSchemaVersion, SchemaVersion)
+	}
+	if err != nil {
+		return err
+	}
+	if version != SchemaVersion {
+		return fmt.Errorf("%w: database has %d, want %d", ErrSchemaVersion, version, SchemaVersion)
+	}
+	return nil
+}
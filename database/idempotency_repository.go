@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/user/footballsim/models"
+)
+
+// SQLIdempotencyRepository implements the IdempotencyRepository interface
+type SQLIdempotencyRepository struct {
+	DB *sql.DB
+}
+
+// NewSQLIdempotencyRepository creates a new SQLIdempotencyRepository
+func NewSQLIdempotencyRepository(db *sql.DB) *SQLIdempotencyRepository {
+	return &SQLIdempotencyRepository{
+		DB: db,
+	}
+}
+
+// Reserve records a new request under its key, first dropping the tenant's keys older than window.
+// A reservation that has not completed within lease is taken to belong to a request that died, and is
+// taken over. When the key is otherwise in use it returns the existing record and false.
+func (r *SQLIdempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord, window, lease time.Duration) (*models.IdempotencyRecord, bool, error) {
+	query := `DELETE FROM idempotency_keys WHERE tenant_id = $1 AND created_at < CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, record.TenantID, window.Seconds())
+	if err != nil {
+		return nil, false, err
+	}
+
+	query = `
+		INSERT INTO idempotency_keys (tenant_id, key, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, created_at = CURRENT_TIMESTAMP
+		WHERE NOT idempotency_keys.completed
+			AND idempotency_keys.created_at < CURRENT_TIMESTAMP - $4 * INTERVAL '1 second'
+		RETURNING created_at`
+
+	err = conn(ctx, r.DB).QueryRowContext(ctx, query, record.TenantID, record.Key, record.RequestHash, lease.Seconds()).Scan(&record.CreatedAt)
+	if err == nil {
+		return record, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	existing, err := r.get(ctx, record.TenantID, record.Key)
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+// Complete stores the response of a reserved request. A reservation that has been taken over is left alone.
+func (r *SQLIdempotencyRepository) Complete(ctx context.Context, record *models.IdempotencyRecord) error {
+	query := `
+		UPDATE idempotency_keys
+		SET completed = true, status = $1, content_type = $2, etag = $3, body = $4
+		WHERE tenant_id = $5 AND key = $6 AND created_at = $7 AND NOT completed`
+
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, record.Status, record.ContentType, record.ETag, record.Body, record.TenantID, record.Key, record.CreatedAt)
+	return err
+}
+
+// Release drops a reservation, so the request can be retried with the same key.
+// A reservation that has been taken over is left alone.
+func (r *SQLIdempotencyRepository) Release(ctx context.Context, record *models.IdempotencyRecord) error {
+	query := `DELETE FROM idempotency_keys WHERE tenant_id = $1 AND key = $2 AND created_at = $3 AND NOT completed`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, record.TenantID, record.Key, record.CreatedAt)
+	return err
+}
+
+// get returns the record of a key
+func (r *SQLIdempotencyRepository) get(ctx context.Context, tenantID int, key string) (*models.IdempotencyRecord, error) {
+	query := `
+		SELECT tenant_id, key, request_hash, completed, status, content_type, etag, body, created_at
+		FROM idempotency_keys
+		WHERE tenant_id = $1 AND key = $2`
+
+	record := &models.IdempotencyRecord{}
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, tenantID, key).Scan(
+		&record.TenantID,
+		&record.Key,
+		&record.RequestHash,
+		&record.Completed,
+		&record.Status,
+		&record.ContentType,
+		&record.ETag,
+		&record.Body,
+		&record.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
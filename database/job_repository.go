@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/user/footballsim/models"
+)
+
+// SQLJobRepository implements the JobRepository interface for the jobs of every tenant
+type SQLJobRepository struct {
+	DB *sql.DB
+}
+
+// NewSQLJobRepository creates a new SQLJobRepository
+func NewSQLJobRepository(db *sql.DB) *SQLJobRepository {
+	return &SQLJobRepository{
+		DB: db,
+	}
+}
+
+// jobColumns are the columns read by scanJob, in order
+const jobColumns = `id, tenant_id, type, params, status, progress_done, progress_total, result, error,
+	cancel_requested, attempts, created_at, started_at, finished_at`
+
+// GetRecent returns a tenant's most recent jobs, newest first
+func (r *SQLJobRepository) GetRecent(ctx context.Context, tenantID, limit int) ([]*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE tenant_id = $1 ORDER BY id DESC LIMIT $2`
+
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, tenantID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*models.Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetByID returns a job of a tenant by ID
+func (r *SQLJobRepository) GetByID(ctx context.Context, tenantID, id int) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1 AND tenant_id = $2`
+	return scanJob(conn(ctx, r.DB).QueryRowContext(ctx, query, id, tenantID))
+}
+
+// Create queues a new job
+func (r *SQLJobRepository) Create(ctx context.Context, job *models.Job) error {
+	query := `
+		INSERT INTO jobs (tenant_id, type, params, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	return conn(ctx, r.DB).QueryRowContext(ctx, query, job.TenantID, job.Type, []byte(job.Params), job.Status).Scan(&job.ID, &job.CreatedAt)
+}
+
+// Claim starts the oldest queued job, or a running job whose worker stopped sending heartbeats for staleAfter.
+// Stale jobs that were cancelled or already started maxAttempts times are closed instead of being run again.
+// It returns nil when there is no job to run.
+func (r *SQLJobRepository) Claim(ctx context.Context, staleAfter time.Duration, maxAttempts int) (*models.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN cancel_requested THEN 'cancelled' ELSE 'failed' END,
+			error = CASE WHEN cancel_requested THEN error ELSE 'the job stopped its worker too many times' END,
+			finished_at = CURRENT_TIMESTAMP
+		WHERE status = 'running'
+			AND heartbeat_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+			AND (cancel_requested OR attempts >= $2)`
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, query, staleAfter.Seconds(), maxAttempts); err != nil {
+		return nil, err
+	}
+
+	// SKIP LOCKED lets the workers of every app instance claim different jobs at the same time
+	query = `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, progress_done = 0, progress_total = 0,
+			started_at = CURRENT_TIMESTAMP, heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'queued'
+				OR (status = 'running' AND heartbeat_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second')
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(conn(ctx, r.DB).QueryRowContext(ctx, query, staleAfter.Seconds()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// Heartbeat records a running job's progress and reports whether it should be cancelled.
+// It returns sql.ErrNoRows when the job has been taken over by another worker.
+func (r *SQLJobRepository) Heartbeat(ctx context.Context, job *models.Job) (bool, error) {
+	query := `
+		UPDATE jobs
+		SET progress_done = $1, progress_total = $2, heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status = 'running' AND attempts = $4
+		RETURNING cancel_requested`
+
+	var cancelRequested bool
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, job.Progress.Done, job.Progress.Total, job.ID, job.Attempts).Scan(&cancelRequested)
+	return cancelRequested, err
+}
+
+// Finish stores the outcome of a running job
+func (r *SQLJobRepository) Finish(ctx context.Context, job *models.Job) error {
+	query := `
+		UPDATE jobs
+		SET status = $1, result = $2, error = $3, progress_done = $4, progress_total = $5, finished_at = CURRENT_TIMESTAMP
+		WHERE id = $6 AND status = 'running' AND attempts = $7`
+
+	// A job without a result stores NULL
+	var result interface{}
+	if len(job.Result) > 0 {
+		result = []byte(job.Result)
+	}
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, job.Status, result, job.Error, job.Progress.Done, job.Progress.Total, job.ID, job.Attempts)
+	return err
+}
+
+// Requeue puts a running job back in the queue, to be started again from the beginning
+func (r *SQLJobRepository) Requeue(ctx context.Context, job *models.Job) error {
+	query := `
+		UPDATE jobs
+		SET status = 'queued', progress_done = 0, progress_total = 0, started_at = NULL, heartbeat_at = NULL
+		WHERE id = $1 AND status = 'running' AND attempts = $2`
+
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, job.ID, job.Attempts)
+	return err
+}
+
+// RequestCancel cancels a queued job at once and flags a running one for its worker to stop.
+// It returns sql.ErrNoRows when the tenant has no such job or the job has already finished.
+func (r *SQLJobRepository) RequestCancel(ctx context.Context, tenantID, id int) (*models.Job, error) {
+	query := `
+		UPDATE jobs
+		SET cancel_requested = true,
+			status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+			finished_at = CASE WHEN status = 'queued' THEN CURRENT_TIMESTAMP ELSE finished_at END
+		WHERE id = $1 AND tenant_id = $2 AND status IN ('queued', 'running')
+		RETURNING ` + jobColumns
+
+	return scanJob(conn(ctx, r.DB).QueryRowContext(ctx, query, id, tenantID))
+}
+
+// scanJob reads a job row
+func scanJob(row rowScanner) (*models.Job, error) {
+	job := &models.Job{}
+	var params, result []byte
+	var startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(
+		&job.ID,
+		&job.TenantID,
+		&job.Type,
+		&params,
+		&job.Status,
+		&job.Progress.Done,
+		&job.Progress.Total,
+		&result,
+		&job.Error,
+		&job.CancelRequested,
+		&job.Attempts,
+		&job.CreatedAt,
+		&startedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Params = params
+	if len(result) > 0 {
+		job.Result = result
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return job, nil
+}
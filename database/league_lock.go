@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log"
+
+	"github.com/user/footballsim/models"
+)
+
+// leagueLockClass is the first key of the league advisory locks, keeping them apart from other advisory locks
+const leagueLockClass = 7341
+
+// SQLLeagueLock implements the LeagueLock interface for a single tenant. Within the process a
+// one-slot channel serializes callers; across app instances and the command line a Postgres
+// session advisory lock, held on its own connection, does.
+type SQLLeagueLock struct {
+	DB       *sql.DB
+	TenantID int
+	local    chan struct{}
+}
+
+// NewSQLLeagueLock creates the league lock of a tenant; share it between everything that changes the tenant's league
+func NewSQLLeagueLock(db *sql.DB, tenantID int) *SQLLeagueLock {
+	return &SQLLeagueLock{
+		DB:       db,
+		TenantID: tenantID,
+		local:    make(chan struct{}, 1),
+	}
+}
+
+// Lock waits until the league is free, or until ctx is done
+func (l *SQLLeagueLock) Lock(ctx context.Context) (func(), error) {
+	select {
+	case l.local <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	conn, err := l.DB.Conn(ctx)
+	if err != nil {
+		<-l.local
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1, $2)`, leagueLockClass, l.TenantID); err != nil {
+		discardConn(conn)
+		<-l.local
+		return nil, err
+	}
+
+	return l.unlock(conn), nil
+}
+
+// TryLock takes the lock only when no one else in this or another process holds it
+func (l *SQLLeagueLock) TryLock(ctx context.Context) (func(), error) {
+	select {
+	case l.local <- struct{}{}:
+	default:
+		return nil, models.ErrLeagueBusy
+	}
+
+	conn, err := l.DB.Conn(ctx)
+	if err != nil {
+		<-l.local
+		return nil, err
+	}
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1, $2)`, leagueLockClass, l.TenantID).Scan(&locked)
+	if err != nil {
+		discardConn(conn)
+		<-l.local
+		return nil, err
+	}
+	if !locked {
+		conn.Close()
+		<-l.local
+		return nil, models.ErrLeagueBusy
+	}
+
+	return l.unlock(conn), nil
+}
+
+// unlock returns the function that releases the advisory lock and the connection holding it
+func (l *SQLLeagueLock) unlock(conn *sql.Conn) func() {
+	return func() {
+		// The request's context may be done by now, and the lock must be released regardless
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1, $2)`, leagueLockClass, l.TenantID); err != nil {
+			log.Printf("Error releasing league lock of tenant %d: %v", l.TenantID, err)
+			discardConn(conn)
+		} else {
+			conn.Close()
+		}
+		<-l.local
+	}
+}
+
+// discardConn closes a connection instead of returning it to the pool. A lock call that failed,
+// for example because its context was cancelled, may still have taken the lock, and ending the
+// session is the only sure way to release it.
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
@@ -1,39 +1,48 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 
 	"github.com/user/footballsim/models"
 )
 
-// SQLLeagueRepository implements the LeagueRepository interface
+// SQLLeagueRepository implements the LeagueRepository interface for a single tenant
 type SQLLeagueRepository struct {
-	DB *sql.DB
+	DB       *sql.DB
+	TenantID int
 }
 
-// NewSQLLeagueRepository creates a new SQLLeagueRepository
-func NewSQLLeagueRepository(db *sql.DB) *SQLLeagueRepository {
+// NewSQLLeagueRepository creates a new SQLLeagueRepository scoped to a tenant
+func NewSQLLeagueRepository(db *sql.DB, tenantID int) *SQLLeagueRepository {
 	return &SQLLeagueRepository{
-		DB: db,
+		DB:       db,
+		TenantID: tenantID,
 	}
 }
 
 // GetCurrent returns the current league
-func (r *SQLLeagueRepository) GetCurrent() (*models.League, error) {
+func (r *SQLLeagueRepository) GetCurrent(ctx context.Context) (*models.League, error) {
 	query := `
-		SELECT id, name, season, current_week, total_weeks, is_completed
+		SELECT id, name, season, current_week, total_weeks, is_completed, prediction_rule, prediction_threshold, version
 		FROM leagues
+		WHERE tenant_id = $1
 		ORDER BY id DESC
 		LIMIT 1`
 
 	league := &models.League{}
-	err := r.DB.QueryRow(query).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, r.TenantID).Scan(
 		&league.ID,
 		&league.Name,
 		&league.Season,
 		&league.CurrentWeek,
 		&league.TotalWeeks,
 		&league.IsCompleted,
+		&league.PredictionRule,
+		&league.PredictionThreshold,
+		&league.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -43,58 +52,74 @@ func (r *SQLLeagueRepository) GetCurrent() (*models.League, error) {
 }
 
 // Create creates a new league
-func (r *SQLLeagueRepository) Create(league *models.League) error {
+func (r *SQLLeagueRepository) Create(ctx context.Context, league *models.League) error {
 	query := `
-		INSERT INTO leagues (name, season, current_week, total_weeks, is_completed)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id`
+		INSERT INTO leagues (name, season, current_week, total_weeks, is_completed, prediction_rule, prediction_threshold, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, version`
 
-	err := r.DB.QueryRow(
+	err := conn(ctx, r.DB).QueryRowContext(
+		ctx,
 		query,
 		league.Name,
 		league.Season,
 		league.CurrentWeek,
 		league.TotalWeeks,
 		league.IsCompleted,
-	).Scan(&league.ID)
+		league.PredictionRule,
+		league.PredictionThreshold,
+		r.TenantID,
+	).Scan(&league.ID, &league.Version)
 
 	return err
 }
 
 // Update updates an existing league
-func (r *SQLLeagueRepository) Update(league *models.League) error {
+func (r *SQLLeagueRepository) Update(ctx context.Context, league *models.League) error {
 	query := `
 		UPDATE leagues
 		SET name = $1,
 			season = $2,
 			current_week = $3,
 			total_weeks = $4,
-			is_completed = $5
-		WHERE id = $6`
-
-	_, err := r.DB.Exec(
+			is_completed = $5,
+			prediction_rule = $6,
+			prediction_threshold = $7,
+			version = version + 1
+		WHERE id = $8 AND tenant_id = $9 AND version = $10
+		RETURNING version`
+
+	err := conn(ctx, r.DB).QueryRowContext(
+		ctx,
 		query,
 		league.Name,
 		league.Season,
 		league.CurrentWeek,
 		league.TotalWeeks,
 		league.IsCompleted,
+		league.PredictionRule,
+		league.PredictionThreshold,
 		league.ID,
-	)
-
+		r.TenantID,
+		league.Version,
+	).Scan(&league.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: league %d is no longer at version %d", models.ErrVersionConflict, league.ID, league.Version)
+	}
 	return err
 }
 
 // GetCurrentWeek returns the current week of the league
-func (r *SQLLeagueRepository) GetCurrentWeek() (int, error) {
+func (r *SQLLeagueRepository) GetCurrentWeek(ctx context.Context) (int, error) {
 	query := `
 		SELECT current_week
 		FROM leagues
+		WHERE tenant_id = $1
 		ORDER BY id DESC
 		LIMIT 1`
 
 	var currentWeek int
-	err := r.DB.QueryRow(query).Scan(&currentWeek)
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, r.TenantID).Scan(&currentWeek)
 	if err != nil {
 		return 0, err
 	}
@@ -103,15 +128,16 @@ func (r *SQLLeagueRepository) GetCurrentWeek() (int, error) {
 }
 
 // GetTotalWeeks returns the total number of weeks in the league
-func (r *SQLLeagueRepository) GetTotalWeeks() (int, error) {
+func (r *SQLLeagueRepository) GetTotalWeeks(ctx context.Context) (int, error) {
 	query := `
 		SELECT total_weeks
 		FROM leagues
+		WHERE tenant_id = $1
 		ORDER BY id DESC
 		LIMIT 1`
 
 	var totalWeeks int
-	err := r.DB.QueryRow(query).Scan(&totalWeeks)
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, r.TenantID).Scan(&totalWeeks)
 	if err != nil {
 		return 0, err
 	}
@@ -120,27 +146,29 @@ func (r *SQLLeagueRepository) GetTotalWeeks() (int, error) {
 }
 
 // UpdateWeek updates the current week of the league
-func (r *SQLLeagueRepository) UpdateWeek(week int) error {
+func (r *SQLLeagueRepository) UpdateWeek(ctx context.Context, week int) error {
 	query := `
 		UPDATE leagues
-		SET current_week = $1
+		SET current_week = $1,
+			version = version + 1
 		WHERE id = (
-			SELECT id FROM leagues ORDER BY id DESC LIMIT 1
+			SELECT id FROM leagues WHERE tenant_id = $2 ORDER BY id DESC LIMIT 1
 		)`
 
-	_, err := r.DB.Exec(query, week)
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, week, r.TenantID)
 	return err
 }
 
 // MarkAsCompleted marks the league as completed
-func (r *SQLLeagueRepository) MarkAsCompleted() error {
+func (r *SQLLeagueRepository) MarkAsCompleted(ctx context.Context) error {
 	query := `
 		UPDATE leagues
-		SET is_completed = true
+		SET is_completed = true,
+			version = version + 1
 		WHERE id = (
-			SELECT id FROM leagues ORDER BY id DESC LIMIT 1
+			SELECT id FROM leagues WHERE tenant_id = $1 ORDER BY id DESC LIMIT 1
 		)`
 
-	_, err := r.DB.Exec(query)
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, r.TenantID)
 	return err
 } 
\ No newline at end of file
@@ -1,260 +1,200 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/user/footballsim/models"
 )
 
-// SQLMatchRepository implements the MatchRepository interface
+// SQLMatchRepository implements the MatchRepository interface for a single tenant
 type SQLMatchRepository struct {
-	DB *sql.DB
+	DB       *sql.DB
+	TenantID int
 }
 
-// NewSQLMatchRepository creates a new SQLMatchRepository
-func NewSQLMatchRepository(db *sql.DB) *SQLMatchRepository {
+// NewSQLMatchRepository creates a new SQLMatchRepository scoped to a tenant
+func NewSQLMatchRepository(db *sql.DB, tenantID int) *SQLMatchRepository {
 	return &SQLMatchRepository{
-		DB: db,
+		DB:       db,
+		TenantID: tenantID,
 	}
 }
 
 // GetAll returns all matches
-func (r *SQLMatchRepository) GetAll() ([]*models.Match, error) {
+func (r *SQLMatchRepository) GetAll(ctx context.Context) ([]*models.Match, error) {
 	query := `
 		SELECT id, week, home_team_id, away_team_id, home_team_name, away_team_name, 
-			   home_team_goals, away_team_goals, played, played_at, is_edited
+			   home_team_goals, away_team_goals, played, played_at, is_edited, version
 		FROM matches
+		WHERE tenant_id = $1
 		ORDER BY week ASC, id ASC`
 
-	rows, err := r.DB.Query(query)
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, r.TenantID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	matches := make([]*models.Match, 0)
-	for rows.Next() {
-		match := &models.Match{}
-		var playedAt sql.NullTime
-		var homeTeamGoals, awayTeamGoals sql.NullInt32
-
-		err := rows.Scan(
-			&match.ID,
-			&match.Week,
-			&match.HomeTeamID,
-			&match.AwayTeamID,
-			&match.HomeTeamName,
-			&match.AwayTeamName,
-			&homeTeamGoals,
-			&awayTeamGoals,
-			&match.Played,
-			&playedAt,
-			&match.IsEdited,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if homeTeamGoals.Valid {
-			match.HomeTeamGoals = int(homeTeamGoals.Int32)
-		}
-
-		if awayTeamGoals.Valid {
-			match.AwayTeamGoals = int(awayTeamGoals.Int32)
-		}
-
-		if playedAt.Valid {
-			match.PlayedAt = playedAt.Time
-		}
-
-		matches = append(matches, match)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return matches, nil
+	return scanMatches(rows)
 }
 
 // GetByID returns a match by ID
-func (r *SQLMatchRepository) GetByID(id int) (*models.Match, error) {
+func (r *SQLMatchRepository) GetByID(ctx context.Context, id int) (*models.Match, error) {
 	query := `
 		SELECT id, week, home_team_id, away_team_id, home_team_name, away_team_name, 
-		       home_team_goals, away_team_goals, played, played_at, is_edited
+		       home_team_goals, away_team_goals, played, played_at, is_edited, version
 		FROM matches
-		WHERE id = $1`
-
-	match := &models.Match{}
-	var playedAt sql.NullTime
-	var homeTeamGoals, awayTeamGoals sql.NullInt32
-
-	err := r.DB.QueryRow(query, id).Scan(
-		&match.ID,
-		&match.Week,
-		&match.HomeTeamID,
-		&match.AwayTeamID,
-		&match.HomeTeamName,
-		&match.AwayTeamName,
-		&homeTeamGoals,
-		&awayTeamGoals,
-		&match.Played,
-		&playedAt,
-		&match.IsEdited,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	if homeTeamGoals.Valid {
-		match.HomeTeamGoals = int(homeTeamGoals.Int32)
-	}
-
-	if awayTeamGoals.Valid {
-		match.AwayTeamGoals = int(awayTeamGoals.Int32)
-	}
-
-	if playedAt.Valid {
-		match.PlayedAt = playedAt.Time
-	}
+		WHERE id = $1 AND tenant_id = $2`
 
-	return match, nil
+	return scanMatch(conn(ctx, r.DB).QueryRowContext(ctx, query, id, r.TenantID))
 }
 
 // GetByWeek returns all matches for a specific week
-func (r *SQLMatchRepository) GetByWeek(week int) ([]*models.Match, error) {
+func (r *SQLMatchRepository) GetByWeek(ctx context.Context, week int) ([]*models.Match, error) {
 	query := `
 		SELECT id, week, home_team_id, away_team_id, home_team_name, away_team_name, 
-		       home_team_goals, away_team_goals, played, played_at, is_edited
+		       home_team_goals, away_team_goals, played, played_at, is_edited, version
 		FROM matches
-		WHERE week = $1
+		WHERE week = $1 AND tenant_id = $2
 		ORDER BY id ASC`
 
-	rows, err := r.DB.Query(query, week)
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, week, r.TenantID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	matches := make([]*models.Match, 0)
-	for rows.Next() {
-		match := &models.Match{}
-		var playedAt sql.NullTime
-		var homeTeamGoals, awayTeamGoals sql.NullInt32
-
-		err := rows.Scan(
-			&match.ID,
-			&match.Week,
-			&match.HomeTeamID,
-			&match.AwayTeamID,
-			&match.HomeTeamName,
-			&match.AwayTeamName,
-			&homeTeamGoals,
-			&awayTeamGoals,
-			&match.Played,
-			&playedAt,
-			&match.IsEdited,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if homeTeamGoals.Valid {
-			match.HomeTeamGoals = int(homeTeamGoals.Int32)
-		}
-
-		if awayTeamGoals.Valid {
-			match.AwayTeamGoals = int(awayTeamGoals.Int32)
-		}
-
-		if playedAt.Valid {
-			match.PlayedAt = playedAt.Time
-		}
-
-		matches = append(matches, match)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return matches, nil
+	return scanMatches(rows)
 }
 
 // GetUnplayed returns all unplayed matches
-func (r *SQLMatchRepository) GetUnplayed() ([]*models.Match, error) {
+func (r *SQLMatchRepository) GetUnplayed(ctx context.Context) ([]*models.Match, error) {
 	query := `
 		SELECT id, week, home_team_id, away_team_id, home_team_name, away_team_name, 
-		       home_team_goals, away_team_goals, played, played_at, is_edited
+		       home_team_goals, away_team_goals, played, played_at, is_edited, version
 		FROM matches
-		WHERE played = false
+		WHERE played = false AND tenant_id = $1
 		ORDER BY week ASC, id ASC`
 
-	rows, err := r.DB.Query(query)
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, r.TenantID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	matches := make([]*models.Match, 0)
-	for rows.Next() {
-		match := &models.Match{}
-		var playedAt sql.NullTime
-		var homeTeamGoals, awayTeamGoals sql.NullInt32
-
-		err := rows.Scan(
-			&match.ID,
-			&match.Week,
-			&match.HomeTeamID,
-			&match.AwayTeamID,
-			&match.HomeTeamName,
-			&match.AwayTeamName,
-			&homeTeamGoals,
-			&awayTeamGoals,
-			&match.Played,
-			&playedAt,
-			&match.IsEdited,
-		)
-		if err != nil {
-			return nil, err
-		}
+	return scanMatches(rows)
+}
 
-		if homeTeamGoals.Valid {
-			match.HomeTeamGoals = int(homeTeamGoals.Int32)
-		}
+// matchSortColumns maps the match sort orders to their ORDER BY expressions
+var matchSortColumns = map[string]string{
+	models.MatchSortWeek:     "week %[1]s, id %[1]s",
+	models.MatchSortID:       "id %[1]s",
+	models.MatchSortPlayedAt: "played_at %[1]s NULLS LAST, id %[1]s",
+	models.MatchSortGoals:    "COALESCE(home_team_goals, 0) + COALESCE(away_team_goals, 0) %[1]s, id %[1]s",
+}
 
-		if awayTeamGoals.Valid {
-			match.AwayTeamGoals = int(awayTeamGoals.Int32)
+// Find returns one page of the matches selected by a validated filter and the number of matches selected
+func (r *SQLMatchRepository) Find(ctx context.Context, filter *models.MatchFilter) ([]*models.Match, int, error) {
+	conditions := []string{"tenant_id = $1"}
+	args := []interface{}{r.TenantID}
+	where := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
 		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
 
-		if playedAt.Valid {
-			match.PlayedAt = playedAt.Time
+	if filter.TeamID != 0 {
+		switch filter.Venue {
+		case models.VenueHome:
+			where("home_team_id = $%d", filter.TeamID)
+		case models.VenueAway:
+			where("away_team_id = $%d", filter.TeamID)
+		default:
+			where("(home_team_id = $%d OR away_team_id = $%d)", filter.TeamID, filter.TeamID)
 		}
+	}
+	if filter.OpponentID != 0 {
+		where("(home_team_id = $%d OR away_team_id = $%d)", filter.OpponentID, filter.OpponentID)
+	}
+	if filter.Played != nil {
+		where("played = $%d", *filter.Played)
+	}
+	if filter.EditedOnly {
+		conditions = append(conditions, "is_edited = true")
+	}
+	if filter.WeekFrom > 0 {
+		where("week >= $%d", filter.WeekFrom)
+	}
+	if filter.WeekTo > 0 {
+		where("week <= $%d", filter.WeekTo)
+	}
+	if !filter.PlayedFrom.IsZero() {
+		where("played_at >= $%d", filter.PlayedFrom)
+	}
+	if !filter.PlayedTo.IsZero() {
+		where("played_at < $%d", filter.PlayedTo)
+	}
+	whereClause := strings.Join(conditions, " AND ")
 
-		matches = append(matches, match)
+	var total int
+	countQuery := "SELECT COUNT(*) FROM matches WHERE " + whereClause
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+	sortColumns, ok := matchSortColumns[filter.Sort]
+	if !ok {
+		sortColumns = matchSortColumns[models.MatchSortWeek]
 	}
 
-	return matches, nil
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	query := fmt.Sprintf(`
+		SELECT id, week, home_team_id, away_team_id, home_team_name, away_team_name,
+		       home_team_goals, away_team_goals, played, played_at, is_edited, version
+		FROM matches
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, whereClause, fmt.Sprintf(sortColumns, direction), len(args)-1, len(args))
+
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	matches, err := scanMatches(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return matches, total, nil
 }
 
 // Create creates a new match
-func (r *SQLMatchRepository) Create(match *models.Match) error {
+func (r *SQLMatchRepository) Create(ctx context.Context, match *models.Match) error {
 	query := `
 		INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name, 
-		                    home_team_goals, away_team_goals, played, played_at, is_edited)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id`
+		                    home_team_goals, away_team_goals, played, played_at, is_edited, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, version`
 
 	var playedAt sql.NullTime
 	if !match.PlayedAt.IsZero() {
 		playedAt = sql.NullTime{Time: match.PlayedAt, Valid: true}
 	}
 
-	err := r.DB.QueryRow(
+	err := conn(ctx, r.DB).QueryRowContext(
+		ctx,
 		query,
 		match.Week,
 		match.HomeTeamID,
@@ -266,13 +206,15 @@ func (r *SQLMatchRepository) Create(match *models.Match) error {
 		match.Played,
 		playedAt,
 		match.IsEdited,
-	).Scan(&match.ID)
+		r.TenantID,
+	).Scan(&match.ID, &match.Version)
 
 	return err
 }
 
-// Update updates an existing match
-func (r *SQLMatchRepository) Update(match *models.Match) error {
+// Update updates an existing match. It returns models.ErrVersionConflict when the match is no longer
+// at match.Version, and sql.ErrNoRows when it no longer exists.
+func (r *SQLMatchRepository) Update(ctx context.Context, match *models.Match) error {
 	query := `
 		UPDATE matches
 		SET week = $1,
@@ -284,15 +226,18 @@ func (r *SQLMatchRepository) Update(match *models.Match) error {
 			away_team_goals = $7,
 			played = $8,
 			played_at = $9,
-			is_edited = $10
-		WHERE id = $11`
+			is_edited = $10,
+			version = version + 1
+		WHERE id = $11 AND tenant_id = $12 AND version = $13
+		RETURNING version`
 
 	var playedAt sql.NullTime
 	if !match.PlayedAt.IsZero() {
 		playedAt = sql.NullTime{Time: match.PlayedAt, Valid: true}
 	}
 
-	_, err := r.DB.Exec(
+	err := conn(ctx, r.DB).QueryRowContext(
+		ctx,
 		query,
 		match.Week,
 		match.HomeTeamID,
@@ -305,14 +250,85 @@ func (r *SQLMatchRepository) Update(match *models.Match) error {
 		playedAt,
 		match.IsEdited,
 		match.ID,
-	)
-
+		r.TenantID,
+		match.Version,
+	).Scan(&match.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		// No row is updated either when the match has moved on to another version or when it is gone
+		var exists bool
+		query = `SELECT EXISTS (SELECT 1 FROM matches WHERE id = $1 AND tenant_id = $2)`
+		if err := conn(ctx, r.DB).QueryRowContext(ctx, query, match.ID, r.TenantID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+		return fmt.Errorf("%w: match %d is no longer at version %d", models.ErrVersionConflict, match.ID, match.Version)
+	}
 	return err
 }
 
 // Delete deletes a match
-func (r *SQLMatchRepository) Delete(id int) error {
-	query := `DELETE FROM matches WHERE id = $1`
-	_, err := r.DB.Exec(query, id)
+func (r *SQLMatchRepository) Delete(ctx context.Context, id int) error {
+	query := `DELETE FROM matches WHERE id = $1 AND tenant_id = $2`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, id, r.TenantID)
 	return err
-} 
\ No newline at end of file
+} 
+
+// rowScanner is a single row of a query, or the current row of a result set
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMatch reads a match row
+func scanMatch(row rowScanner) (*models.Match, error) {
+	match := &models.Match{}
+	var playedAt sql.NullTime
+	var homeTeamGoals, awayTeamGoals sql.NullInt32
+
+	err := row.Scan(
+		&match.ID,
+		&match.Week,
+		&match.HomeTeamID,
+		&match.AwayTeamID,
+		&match.HomeTeamName,
+		&match.AwayTeamName,
+		&homeTeamGoals,
+		&awayTeamGoals,
+		&match.Played,
+		&playedAt,
+		&match.IsEdited,
+		&match.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if homeTeamGoals.Valid {
+		match.HomeTeamGoals = int(homeTeamGoals.Int32)
+	}
+	if awayTeamGoals.Valid {
+		match.AwayTeamGoals = int(awayTeamGoals.Int32)
+	}
+	if playedAt.Valid {
+		match.PlayedAt = playedAt.Time
+	}
+	return match, nil
+}
+
+// scanMatches reads every match row of a query
+func scanMatches(rows *sql.Rows) ([]*models.Match, error) {
+	matches := make([]*models.Match, 0)
+	for rows.Next() {
+		match, err := scanMatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
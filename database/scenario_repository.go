@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/user/footballsim/models"
+)
+
+// SQLScenarioRepository implements the ScenarioRepository interface for a single tenant
+type SQLScenarioRepository struct {
+	DB       *sql.DB
+	TenantID int
+}
+
+// NewSQLScenarioRepository creates a new SQLScenarioRepository scoped to a tenant
+func NewSQLScenarioRepository(db *sql.DB, tenantID int) *SQLScenarioRepository {
+	return &SQLScenarioRepository{
+		DB:       db,
+		TenantID: tenantID,
+	}
+}
+
+// GetAll returns all saved scenarios
+func (r *SQLScenarioRepository) GetAll(ctx context.Context) ([]*models.Scenario, error) {
+	query := `
+		SELECT id, name, pinned_results, runs, created_at
+		FROM scenarios
+		WHERE tenant_id = $1
+		ORDER BY id DESC`
+
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, r.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scenarios := make([]*models.Scenario, 0)
+	for rows.Next() {
+		scenario := &models.Scenario{}
+		var pinnedResults []byte
+
+		err := rows.Scan(
+			&scenario.ID,
+			&scenario.Name,
+			&pinnedResults,
+			&scenario.Runs,
+			&scenario.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(pinnedResults, &scenario.PinnedResults); err != nil {
+			return nil, err
+		}
+
+		scenarios = append(scenarios, scenario)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return scenarios, nil
+}
+
+// GetByID returns a scenario by ID
+func (r *SQLScenarioRepository) GetByID(ctx context.Context, id int) (*models.Scenario, error) {
+	query := `
+		SELECT id, name, pinned_results, runs, created_at
+		FROM scenarios
+		WHERE id = $1 AND tenant_id = $2`
+
+	scenario := &models.Scenario{}
+	var pinnedResults []byte
+
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, id, r.TenantID).Scan(
+		&scenario.ID,
+		&scenario.Name,
+		&pinnedResults,
+		&scenario.Runs,
+		&scenario.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(pinnedResults, &scenario.PinnedResults); err != nil {
+		return nil, err
+	}
+
+	return scenario, nil
+}
+
+// Create saves a new scenario
+func (r *SQLScenarioRepository) Create(ctx context.Context, scenario *models.Scenario) error {
+	query := `
+		INSERT INTO scenarios (name, pinned_results, runs, tenant_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	pinnedResults, err := json.Marshal(scenario.PinnedResults)
+	if err != nil {
+		return err
+	}
+
+	return conn(ctx, r.DB).QueryRowContext(
+		ctx,
+		query,
+		scenario.Name,
+		string(pinnedResults),
+		scenario.Runs,
+		r.TenantID,
+	).Scan(&scenario.ID, &scenario.CreatedAt)
+}
+
+// Delete deletes a scenario
+func (r *SQLScenarioRepository) Delete(ctx context.Context, id int) error {
+	query := `DELETE FROM scenarios WHERE id = $1 AND tenant_id = $2`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, id, r.TenantID)
+	return err
+}
@@ -1,8 +1,22 @@
 -- Schema for the football simulation database
 
+-- Tenants table (workspaces that each have their own teams, matches and leagues)
+CREATE TABLE IF NOT EXISTS tenants (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The default tenant owns the sample league and serves requests without a tenant
+INSERT INTO tenants (id, slug, name) VALUES (1, 'default', 'Default')
+ON CONFLICT (id) DO NOTHING;
+SELECT setval('tenants_id_seq', GREATEST((SELECT MAX(id) FROM tenants), 1));
+
 -- Teams table
 CREATE TABLE IF NOT EXISTS teams (
     id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
     name VARCHAR(100) NOT NULL,
     played INTEGER NOT NULL DEFAULT 0,
     won INTEGER NOT NULL DEFAULT 0,
@@ -12,23 +26,31 @@ CREATE TABLE IF NOT EXISTS teams (
     goals_against INTEGER NOT NULL DEFAULT 0,
     goal_difference INTEGER NOT NULL DEFAULT 0,
     points INTEGER NOT NULL DEFAULT 0,
-    strength INTEGER NOT NULL DEFAULT 5
+    strength INTEGER NOT NULL DEFAULT 5,
+    attack DOUBLE PRECISION NOT NULL DEFAULT 1.0,
+    defence DOUBLE PRECISION NOT NULL DEFAULT 1.0,
+    version INTEGER NOT NULL DEFAULT 1
 );
 
 -- League table
 CREATE TABLE IF NOT EXISTS leagues (
     id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
     name VARCHAR(100) NOT NULL,
     season VARCHAR(20) NOT NULL,
     current_week INTEGER NOT NULL DEFAULT 1,
     total_weeks INTEGER NOT NULL,
     is_completed BOOLEAN NOT NULL DEFAULT FALSE,
+    prediction_rule VARCHAR(20) NOT NULL DEFAULT 'min_weeks',
+    prediction_threshold INTEGER NOT NULL DEFAULT 4,
+    version INTEGER NOT NULL DEFAULT 1,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 -- Matches table
 CREATE TABLE IF NOT EXISTS matches (
     id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
     week INTEGER NOT NULL,
     home_team_id INTEGER NOT NULL REFERENCES teams(id),
     away_team_id INTEGER NOT NULL REFERENCES teams(id),
@@ -39,6 +61,7 @@ CREATE TABLE IF NOT EXISTS matches (
     played BOOLEAN NOT NULL DEFAULT FALSE,
     played_at TIMESTAMP,
     is_edited BOOLEAN NOT NULL DEFAULT FALSE,
+    version INTEGER NOT NULL DEFAULT 1,
     CONSTRAINT different_teams CHECK (home_team_id != away_team_id)
 );
 
@@ -53,113 +76,86 @@ CREATE TABLE IF NOT EXISTS predictions (
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
--- Delete any existing data to prevent duplicates (in correct dependency order)
-TRUNCATE TABLE predictions CASCADE;
-TRUNCATE TABLE matches CASCADE;
-TRUNCATE TABLE leagues CASCADE;
-TRUNCATE TABLE teams RESTART IDENTITY CASCADE;
-
--- Insert sample teams
-INSERT INTO teams (name, strength) VALUES 
-('Manchester City', 9),
-('Liverpool', 8),
-('Arsenal', 7),
-('Chelsea', 7);
-
--- Create a new league
-INSERT INTO leagues (name, season, total_weeks) VALUES 
-('Premier League', '2023-2024', 18);
-
--- First round: each team plays against each other team once
--- Week 1
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(1, 1, 2, 'Manchester City', 'Liverpool'),
-(1, 3, 4, 'Arsenal', 'Chelsea');
-
--- Week 2
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(2, 1, 3, 'Manchester City', 'Arsenal'),
-(2, 2, 4, 'Liverpool', 'Chelsea');
-
--- Week 3
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(3, 1, 4, 'Manchester City', 'Chelsea'),
-(3, 2, 3, 'Liverpool', 'Arsenal');
-
--- Second round: each team plays against each other team again (reversed venues)
--- Week 4
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(4, 2, 1, 'Liverpool', 'Manchester City'),
-(4, 4, 3, 'Chelsea', 'Arsenal');
-
--- Week 5
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(5, 3, 1, 'Arsenal', 'Manchester City'),
-(5, 4, 2, 'Chelsea', 'Liverpool');
-
--- Week 6
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(6, 4, 1, 'Chelsea', 'Manchester City'),
-(6, 3, 2, 'Arsenal', 'Liverpool');
-
--- Third round: each team plays against each other team a third time
--- Week 7
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(7, 1, 2, 'Manchester City', 'Liverpool'),
-(7, 3, 4, 'Arsenal', 'Chelsea');
-
--- Week 8
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(8, 1, 3, 'Manchester City', 'Arsenal'),
-(8, 2, 4, 'Liverpool', 'Chelsea');
-
--- Week 9
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(9, 1, 4, 'Manchester City', 'Chelsea'),
-(9, 2, 3, 'Liverpool', 'Arsenal');
-
--- Week 10
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(10, 2, 1, 'Liverpool', 'Manchester City'),
-(10, 4, 3, 'Chelsea', 'Arsenal');
-
--- Week 11
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(11, 3, 1, 'Arsenal', 'Manchester City'),
-(11, 4, 2, 'Chelsea', 'Liverpool');
-
--- Week 12
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(12, 4, 1, 'Chelsea', 'Manchester City'),
-(12, 3, 2, 'Arsenal', 'Liverpool');
-
--- Fourth round (making sure each team plays with others exactly 3 times)
--- Week 13
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(13, 1, 2, 'Manchester City', 'Liverpool'),
-(13, 4, 3, 'Chelsea', 'Arsenal');
-
--- Week 14
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(14, 3, 1, 'Arsenal', 'Manchester City'),
-(14, 2, 4, 'Liverpool', 'Chelsea');
+-- Scenarios table (saved what-if questions, pinned results stored as JSON)
+CREATE TABLE IF NOT EXISTS scenarios (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
+    name VARCHAR(100) NOT NULL,
+    pinned_results JSONB NOT NULL DEFAULT '[]',
+    runs INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
 
--- Week 15
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(15, 1, 4, 'Manchester City', 'Chelsea'),
-(15, 3, 2, 'Arsenal', 'Liverpool');
+-- API keys table (only the SHA-256 hash of each key is stored)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
+    name VARCHAR(100) NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
 
--- Week 16
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(16, 2, 1, 'Liverpool', 'Manchester City'),
-(16, 3, 4, 'Arsenal', 'Chelsea');
+-- Idempotency keys table (responses of POST and PUT requests made with an Idempotency-Key, kept for a window)
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    tenant_id INTEGER NOT NULL REFERENCES tenants(id),
+    key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    status INTEGER NOT NULL DEFAULT 0,
+    content_type VARCHAR(100) NOT NULL DEFAULT '',
+    etag VARCHAR(64) NOT NULL DEFAULT '',
+    body BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, key)
+);
 
--- Week 17
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(17, 1, 3, 'Manchester City', 'Arsenal'),
-(17, 4, 2, 'Chelsea', 'Liverpool');
+-- Jobs table (long operations run by the worker pool; params and result stored as JSON)
+CREATE TABLE IF NOT EXISTS jobs (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL REFERENCES tenants(id),
+    type VARCHAR(30) NOT NULL,
+    params JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    progress_done INTEGER NOT NULL DEFAULT 0,
+    progress_total INTEGER NOT NULL DEFAULT 0,
+    result JSONB,
+    error TEXT NOT NULL DEFAULT '',
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    heartbeat_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
 
--- Week 18
-INSERT INTO matches (week, home_team_id, away_team_id, home_team_name, away_team_name) VALUES 
-(18, 4, 1, 'Chelsea', 'Manchester City'),
-(18, 2, 3, 'Liverpool', 'Arsenal'); 
\ No newline at end of file
+-- Columns added after the first release, for databases created before them
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS attack DOUBLE PRECISION NOT NULL DEFAULT 1.0;
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS defence DOUBLE PRECISION NOT NULL DEFAULT 1.0;
+ALTER TABLE leagues ADD COLUMN IF NOT EXISTS prediction_rule VARCHAR(20) NOT NULL DEFAULT 'min_weeks';
+ALTER TABLE leagues ADD COLUMN IF NOT EXISTS prediction_threshold INTEGER NOT NULL DEFAULT 4;
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE leagues ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE leagues ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_teams_tenant ON teams (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_leagues_tenant ON leagues (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_matches_tenant_week ON matches (tenant_id, week);
+CREATE INDEX IF NOT EXISTS idx_jobs_tenant ON jobs (tenant_id, id);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs (status, id);
+
+-- Team names are unique within a tenant, ignoring case. Rename duplicates before migrating a database that has any.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_teams_tenant_name ON teams (tenant_id, LOWER(name));
+
+-- Schema version, checked by the readiness probe; keep in step with SchemaVersion in db.go
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER NOT NULL
+);
+DELETE FROM schema_version;
+INSERT INTO schema_version (version) VALUES (5);
@@ -0,0 +1,67 @@
+-- Sample data for the default tenant, loaded by "seed" and on every "serve" start.
+-- It needs the schema from sql_schema.sql.
+
+-- Reset the sample league of the default tenant (in correct dependency order).
+-- Other tenants keep their data across restarts.
+TRUNCATE TABLE predictions CASCADE;
+DELETE FROM scenarios WHERE tenant_id = 1;
+DELETE FROM matches WHERE tenant_id = 1;
+DELETE FROM leagues WHERE tenant_id = 1;
+DELETE FROM teams WHERE tenant_id = 1;
+
+-- Insert sample teams
+INSERT INTO teams (tenant_id, name, strength) VALUES 
+(1, 'Manchester City', 9),
+(1, 'Liverpool', 8),
+(1, 'Arsenal', 7),
+(1, 'Chelsea', 7);
+
+-- Create a new league
+INSERT INTO leagues (tenant_id, name, season, total_weeks) VALUES 
+(1, 'Premier League', '2023-2024', 18);
+
+-- Fixtures: each pair of teams meets six times over 18 weeks, alternating venues.
+-- Team IDs are looked up by name so the seed does not depend on ID sequences.
+INSERT INTO matches (tenant_id, week, home_team_id, away_team_id, home_team_name, away_team_name)
+SELECT 1, f.week, home.id, away.id, f.home_team_name, f.away_team_name
+FROM (VALUES
+    (1, 'Manchester City', 'Liverpool'),
+    (1, 'Arsenal', 'Chelsea'),
+    (2, 'Manchester City', 'Arsenal'),
+    (2, 'Liverpool', 'Chelsea'),
+    (3, 'Manchester City', 'Chelsea'),
+    (3, 'Liverpool', 'Arsenal'),
+    (4, 'Liverpool', 'Manchester City'),
+    (4, 'Chelsea', 'Arsenal'),
+    (5, 'Arsenal', 'Manchester City'),
+    (5, 'Chelsea', 'Liverpool'),
+    (6, 'Chelsea', 'Manchester City'),
+    (6, 'Arsenal', 'Liverpool'),
+    (7, 'Manchester City', 'Liverpool'),
+    (7, 'Arsenal', 'Chelsea'),
+    (8, 'Manchester City', 'Arsenal'),
+    (8, 'Liverpool', 'Chelsea'),
+    (9, 'Manchester City', 'Chelsea'),
+    (9, 'Liverpool', 'Arsenal'),
+    (10, 'Liverpool', 'Manchester City'),
+    (10, 'Chelsea', 'Arsenal'),
+    (11, 'Arsenal', 'Manchester City'),
+    (11, 'Chelsea', 'Liverpool'),
+    (12, 'Chelsea', 'Manchester City'),
+    (12, 'Arsenal', 'Liverpool'),
+    (13, 'Manchester City', 'Liverpool'),
+    (13, 'Chelsea', 'Arsenal'),
+    (14, 'Arsenal', 'Manchester City'),
+    (14, 'Liverpool', 'Chelsea'),
+    (15, 'Manchester City', 'Chelsea'),
+    (15, 'Arsenal', 'Liverpool'),
+    (16, 'Liverpool', 'Manchester City'),
+    (16, 'Arsenal', 'Chelsea'),
+    (17, 'Manchester City', 'Arsenal'),
+    (17, 'Chelsea', 'Liverpool'),
+    (18, 'Chelsea', 'Manchester City'),
+    (18, 'Liverpool', 'Arsenal')
+) AS f (week, home_team_name, away_team_name)
+JOIN teams home ON home.tenant_id = 1 AND home.name = f.home_team_name
+JOIN teams away ON away.tenant_id = 1 AND away.name = f.away_team_name
+ORDER BY f.week;
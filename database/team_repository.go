@@ -1,31 +1,38 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 
+	"github.com/lib/pq"
 	"github.com/user/footballsim/models"
 )
 
-// SQLTeamRepository implements the TeamRepository interface
+// SQLTeamRepository implements the TeamRepository interface for a single tenant
 type SQLTeamRepository struct {
-	DB *sql.DB
+	DB       *sql.DB
+	TenantID int
 }
 
-// NewSQLTeamRepository creates a new SQLTeamRepository
-func NewSQLTeamRepository(db *sql.DB) *SQLTeamRepository {
+// NewSQLTeamRepository creates a new SQLTeamRepository scoped to a tenant
+func NewSQLTeamRepository(db *sql.DB, tenantID int) *SQLTeamRepository {
 	return &SQLTeamRepository{
-		DB: db,
+		DB:       db,
+		TenantID: tenantID,
 	}
 }
 
 // GetAll returns all teams
-func (r *SQLTeamRepository) GetAll() ([]*models.Team, error) {
+func (r *SQLTeamRepository) GetAll(ctx context.Context) ([]*models.Team, error) {
 	query := `
-		SELECT DISTINCT id, name, played, won, drawn, lost, goals_for, goals_against, goal_difference, points, strength
+		SELECT DISTINCT id, name, played, won, drawn, lost, goals_for, goals_against, goal_difference, points, strength, attack, defence, version
 		FROM teams
+		WHERE tenant_id = $1
 		ORDER BY points DESC, goal_difference DESC, goals_for DESC`
 
-	rows, err := r.DB.Query(query)
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, r.TenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +53,9 @@ func (r *SQLTeamRepository) GetAll() ([]*models.Team, error) {
 			&team.GoalDifference,
 			&team.Points,
 			&team.Strength,
+			&team.Attack,
+			&team.Defence,
+			&team.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -61,14 +71,14 @@ func (r *SQLTeamRepository) GetAll() ([]*models.Team, error) {
 }
 
 // GetByID returns a team by ID
-func (r *SQLTeamRepository) GetByID(id int) (*models.Team, error) {
+func (r *SQLTeamRepository) GetByID(ctx context.Context, id int) (*models.Team, error) {
 	query := `
-		SELECT id, name, played, won, drawn, lost, goals_for, goals_against, goal_difference, points, strength
+		SELECT id, name, played, won, drawn, lost, goals_for, goals_against, goal_difference, points, strength, attack, defence, version
 		FROM teams
-		WHERE id = $1`
+		WHERE id = $1 AND tenant_id = $2`
 
 	team := &models.Team{}
-	err := r.DB.QueryRow(query, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, id, r.TenantID).Scan(
 		&team.ID,
 		&team.Name,
 		&team.Played,
@@ -80,6 +90,9 @@ func (r *SQLTeamRepository) GetByID(id int) (*models.Team, error) {
 		&team.GoalDifference,
 		&team.Points,
 		&team.Strength,
+		&team.Attack,
+		&team.Defence,
+		&team.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -89,13 +102,14 @@ func (r *SQLTeamRepository) GetByID(id int) (*models.Team, error) {
 }
 
 // Create creates a new team
-func (r *SQLTeamRepository) Create(team *models.Team) error {
+func (r *SQLTeamRepository) Create(ctx context.Context, team *models.Team) error {
 	query := `
-		INSERT INTO teams (name, played, won, drawn, lost, goals_for, goals_against, goal_difference, points, strength)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id`
+		INSERT INTO teams (name, played, won, drawn, lost, goals_for, goals_against, goal_difference, points, strength, attack, defence, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, version`
 
-	err := r.DB.QueryRow(
+	err := conn(ctx, r.DB).QueryRowContext(
+		ctx,
 		query,
 		team.Name,
 		team.Played,
@@ -107,13 +121,16 @@ func (r *SQLTeamRepository) Create(team *models.Team) error {
 		team.GoalDifference,
 		team.Points,
 		team.Strength,
-	).Scan(&team.ID)
+		teamRating(team.Attack),
+		teamRating(team.Defence),
+		r.TenantID,
+	).Scan(&team.ID, &team.Version)
 
-	return err
+	return teamNameError(err, team.Name)
 }
 
 // Update updates an existing team
-func (r *SQLTeamRepository) Update(team *models.Team) error {
+func (r *SQLTeamRepository) Update(ctx context.Context, team *models.Team) error {
 	query := `
 		UPDATE teams
 		SET name = $1,
@@ -125,10 +142,15 @@ func (r *SQLTeamRepository) Update(team *models.Team) error {
 			goals_against = $7,
 			goal_difference = $8,
 			points = $9,
-			strength = $10
-		WHERE id = $11`
-
-	_, err := r.DB.Exec(
+			strength = $10,
+			attack = $11,
+			defence = $12,
+			version = version + 1
+		WHERE id = $13 AND tenant_id = $14 AND version = $15
+		RETURNING version`
+
+	err := conn(ctx, r.DB).QueryRowContext(
+		ctx,
 		query,
 		team.Name,
 		team.Played,
@@ -140,15 +162,44 @@ func (r *SQLTeamRepository) Update(team *models.Team) error {
 		team.GoalDifference,
 		team.Points,
 		team.Strength,
+		teamRating(team.Attack),
+		teamRating(team.Defence),
 		team.ID,
-	)
+		r.TenantID,
+		team.Version,
+	).Scan(&team.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: team %d is no longer at version %d", models.ErrVersionConflict, team.ID, team.Version)
+	}
+	return teamNameError(err, team.Name)
+}
 
+// Delete deletes a team
+func (r *SQLTeamRepository) Delete(ctx context.Context, id int) error {
+	query := `DELETE FROM teams WHERE id = $1 AND tenant_id = $2`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, id, r.TenantID)
 	return err
+} 
+// teamRating returns the stored value for an attack or defence rating,
+// falling back to the league average when the rating has not been set
+func teamRating(rating float64) float64 {
+	if rating <= 0 {
+		return 1.0
+	}
+	return rating
 }
 
-// Delete deletes a team
-func (r *SQLTeamRepository) Delete(id int) error {
-	query := `DELETE FROM teams WHERE id = $1`
-	_, err := r.DB.Exec(query, id)
+// teamNameUniqueIndex is the unique index on the names of a tenant's teams
+const teamNameUniqueIndex = "idx_teams_tenant_name"
+
+// uniqueViolation is the Postgres error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// teamNameError turns a violation of the unique team name index into models.ErrDuplicateTeamName
+func teamNameError(err error, name string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == teamNameUniqueIndex {
+		return fmt.Errorf("%w: a team called %q already exists", models.ErrDuplicateTeamName, name)
+	}
 	return err
-} 
\ No newline at end of file
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/user/footballsim/models"
+)
+
+// SQLTenantRepository implements the TenantRepository interface
+type SQLTenantRepository struct {
+	DB *sql.DB
+}
+
+// NewSQLTenantRepository creates a new SQLTenantRepository
+func NewSQLTenantRepository(db *sql.DB) *SQLTenantRepository {
+	return &SQLTenantRepository{
+		DB: db,
+	}
+}
+
+// GetAll returns all tenants
+func (r *SQLTenantRepository) GetAll(ctx context.Context) ([]*models.Tenant, error) {
+	query := `
+		SELECT id, slug, name, created_at
+		FROM tenants
+		ORDER BY id ASC`
+
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := make([]*models.Tenant, 0)
+	for rows.Next() {
+		tenant := &models.Tenant{}
+		err := rows.Scan(
+			&tenant.ID,
+			&tenant.Slug,
+			&tenant.Name,
+			&tenant.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tenants, nil
+}
+
+// GetBySlug returns a tenant by its slug
+func (r *SQLTenantRepository) GetBySlug(ctx context.Context, slug string) (*models.Tenant, error) {
+	query := `
+		SELECT id, slug, name, created_at
+		FROM tenants
+		WHERE slug = $1`
+
+	tenant := &models.Tenant{}
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, slug).Scan(
+		&tenant.ID,
+		&tenant.Slug,
+		&tenant.Name,
+		&tenant.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return tenant, nil
+}
+
+// GetByID returns a tenant by ID
+func (r *SQLTenantRepository) GetByID(ctx context.Context, id int) (*models.Tenant, error) {
+	query := `
+		SELECT id, slug, name, created_at
+		FROM tenants
+		WHERE id = $1`
+
+	tenant := &models.Tenant{}
+	err := conn(ctx, r.DB).QueryRowContext(ctx, query, id).Scan(
+		&tenant.ID,
+		&tenant.Slug,
+		&tenant.Name,
+		&tenant.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return tenant, nil
+}
+
+// Create creates a new tenant and gives it a fresh copy of the default tenant's league,
+// with all results cleared, so that the new workspace is usable straight away
+func (r *SQLTenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO tenants (slug, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at`,
+		tenant.Slug,
+		tenant.Name,
+	).Scan(&tenant.ID, &tenant.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO teams (tenant_id, name, strength, attack, defence)
+		SELECT $1, name, strength, attack, defence
+		FROM teams
+		WHERE tenant_id = $2
+		ORDER BY id ASC`,
+		tenant.ID, models.DefaultTenantID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO leagues (tenant_id, name, season, total_weeks, prediction_rule, prediction_threshold)
+		SELECT $1, name, season, total_weeks, prediction_rule, prediction_threshold
+		FROM leagues
+		WHERE tenant_id = $2
+		ORDER BY id DESC
+		LIMIT 1`,
+		tenant.ID, models.DefaultTenantID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO matches (tenant_id, week, home_team_id, away_team_id, home_team_name, away_team_name)
+		SELECT $1, m.week, home.id, away.id, m.home_team_name, m.away_team_name
+		FROM matches m
+		JOIN teams home ON home.tenant_id = $1 AND home.name = m.home_team_name
+		JOIN teams away ON away.tenant_id = $1 AND away.name = m.away_team_name
+		WHERE m.tenant_id = $2
+		ORDER BY m.week ASC, m.id ASC`,
+		tenant.ID, models.DefaultTenantID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CurrentWeeks returns the current week of each tenant's league, by tenant slug.
+// Tenants without a league are left out.
+func (r *SQLTenantRepository) CurrentWeeks(ctx context.Context) (map[string]int, error) {
+	query := `
+		SELECT DISTINCT ON (t.id) t.slug, l.current_week
+		FROM tenants t
+		JOIN leagues l ON l.tenant_id = t.id
+		ORDER BY t.id, l.id DESC`
+
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	weeks := make(map[string]int)
+	for rows.Next() {
+		var slug string
+		var week int
+		if err := rows.Scan(&slug, &week); err != nil {
+			return nil, err
+		}
+		weeks[slug] = week
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return weeks, nil
+}
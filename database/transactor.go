@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/user/footballsim/metrics"
+)
+
+// txKey is the context key of the transaction started by SQLTransactor.InTx
+type txKey struct{}
+
+// querier is the part of *sql.DB and *sql.Tx that the repositories use
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// SQLTransactor implements the Transactor interface. The repositories run their queries in the
+// transaction carried by the context, so they take part without changes.
+type SQLTransactor struct {
+	DB *sql.DB
+}
+
+// NewSQLTransactor creates a new SQLTransactor
+func NewSQLTransactor(db *sql.DB) *SQLTransactor {
+	return &SQLTransactor{
+		DB: db,
+	}
+}
+
+// InTx runs fn in a transaction, committing it when fn succeeds and rolling it back otherwise.
+// Called within a transaction, fn joins the one already running.
+func (t *SQLTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return countError(err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return countError(tx.Commit())
+}
+
+// conn returns the transaction carried by ctx, or db when there is none, counting the errors of its queries
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return countingQuerier{tx}
+	}
+	return countingQuerier{db}
+}
+
+// countingQuerier counts the failed queries of a querier in the database error metric
+type countingQuerier struct {
+	querier
+}
+
+func (q countingQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	result, err := q.querier.ExecContext(ctx, query, args...)
+	return result, countError(err)
+}
+
+func (q countingQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := q.querier.QueryContext(ctx, query, args...)
+	return rows, countError(err)
+}
+
+func (q countingQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	row := q.querier.QueryRowContext(ctx, query, args...)
+	// Err reports the query's own failure; finding no rows only shows when the row is scanned
+	countError(row.Err())
+	return row
+}
+
+// countError counts err in the database error metric, unless it is nil or the query was cancelled, and returns it
+func countError(err error) error {
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, sql.ErrNoRows) {
+		metrics.DBErrors.Inc()
+	}
+	return err
+}
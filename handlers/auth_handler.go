@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// apiKeyLocal is the fiber.Ctx locals key holding the authenticated API key
+const apiKeyLocal = "api_key"
+
+// AuthHandler handles API key management and authorisation
+type AuthHandler struct {
+	KeyRepo services.APIKeyRepository
+	Auth    *services.AuthService
+}
+
+// NewAuthHandler creates a new AuthHandler
+func NewAuthHandler(keyRepo services.APIKeyRepository, auth *services.AuthService) *AuthHandler {
+	return &AuthHandler{
+		KeyRepo: keyRepo,
+		Auth:    auth,
+	}
+}
+
+// RequireTenantAccess returns middleware that keeps every API request within the tenants its caller may see.
+// A request with an API key must use a key of the request's tenant. A request without one may only read
+// the tenant of its host name, so X-Tenant naming another tenant needs a key.
+func (h *AuthHandler) RequireTenantAccess() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := requestAPIKey(c)
+		if key == "" {
+			if fromHeader, _ := c.Locals(tenantFromHeaderLocal).(bool); fromHeader {
+				return problem(c, http.StatusUnauthorized, "API key required to use the "+TenantHeader+" header")
+			}
+			return c.Next()
+		}
+
+		if apiKey, err := h.authenticate(c, key); apiKey == nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// RequireRole returns middleware that only lets through requests whose API key has at least the given role.
+// The key is read from the X-API-Key header or an "Authorization: Bearer" header.
+func (h *AuthHandler) RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		apiKey, ok := c.Locals(apiKeyLocal).(*models.APIKey)
+		if !ok {
+			key := requestAPIKey(c)
+			if key == "" {
+				return problem(c, http.StatusUnauthorized, "API key required")
+			}
+
+			var err error
+			if apiKey, err = h.authenticate(c, key); apiKey == nil {
+				return err
+			}
+		}
+
+		if !apiKey.HasRole(role) {
+			return problem(c, http.StatusForbidden, "This action requires the "+role+" role")
+		}
+
+		return c.Next()
+	}
+}
+
+// authenticate checks an API key against the request's tenant and stores it for the handlers.
+// On failure it writes the problem response and returns a nil key.
+func (h *AuthHandler) authenticate(c *fiber.Ctx, key string) (*models.APIKey, error) {
+	apiKey, err := h.Auth.Authenticate(c.UserContext(), key)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			return nil, problem(c, http.StatusUnauthorized, "Invalid API key")
+		}
+		return nil, problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	if !apiKey.CanAccessTenant(currentWorkspace(c).Tenant.ID) {
+		return nil, problem(c, http.StatusForbidden, "This API key belongs to another tenant")
+	}
+
+	c.Locals(apiKeyLocal, apiKey)
+	return apiKey, nil
+}
+
+// requestAPIKey returns the API key sent in the X-API-Key header or an "Authorization: Bearer" header
+func requestAPIKey(c *fiber.Ctx) string {
+	if key := c.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// RequirePlatformAdmin returns middleware for actions across tenants, which only the bootstrap admin key may perform.
+// It must run after RequireRole.
+func (h *AuthHandler) RequirePlatformAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		apiKey, ok := c.Locals(apiKeyLocal).(*models.APIKey)
+		if !ok || apiKey.TenantID != 0 || !apiKey.HasRole(models.RoleAdmin) {
+			return problem(c, http.StatusForbidden, "This action requires the platform admin key")
+		}
+		return c.Next()
+	}
+}
+
+// GetCurrentKey returns the API key used for the request
+func (h *AuthHandler) GetCurrentKey(c *fiber.Ctx) error {
+	return c.JSON(c.Locals(apiKeyLocal))
+}
+
+// GetAllKeys returns all API keys of the request's tenant without their secrets
+func (h *AuthHandler) GetAllKeys(c *fiber.Ctx) error {
+	keys, err := h.KeyRepo.GetAll(c.UserContext(), currentWorkspace(c).Tenant.ID)
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(keys)
+}
+
+// CreateKey issues a new API key in the request's tenant. The key itself is only shown in this response.
+func (h *AuthHandler) CreateKey(c *fiber.Ctx) error {
+	var keyData struct {
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+
+	if err := c.BodyParser(&keyData); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+
+	if keyData.Name == "" {
+		return problem(c, http.StatusBadRequest, "Key name is required")
+	}
+
+	apiKey, key, err := h.Auth.CreateKey(c.UserContext(), currentWorkspace(c).Tenant.ID, keyData.Name, keyData.Role)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRole) {
+			return problem(c, http.StatusBadRequest, "Role must be one of viewer, editor or admin")
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.Status(http.StatusCreated).JSON(struct {
+		*models.APIKey
+		Key string `json:"key"`
+	}{apiKey, key})
+}
+
+// DeleteKey revokes an API key of the request's tenant
+func (h *AuthHandler) DeleteKey(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid key ID")
+	}
+
+	if err := h.KeyRepo.Delete(c.UserContext(), currentWorkspace(c).Tenant.ID, id); err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.SendStatus(http.StatusNoContent)
+}
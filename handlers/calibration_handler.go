@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// CalibrationHandler handles team rating calibration requests
+type CalibrationHandler struct {
+	Calibrator *services.Calibrator
+}
+
+// NewCalibrationHandler creates a new CalibrationHandler
+func NewCalibrationHandler(calibrator *services.Calibrator) *CalibrationHandler {
+	return &CalibrationHandler{
+		Calibrator: calibrator,
+	}
+}
+
+// CalibrateRatings fits team ratings to historical results and writes them back to the teams.
+// Results come from an uploaded CSV file ("file" form field or a text/csv body) or,
+// when none is given, from the matches already played in the database.
+func (h *CalibrationHandler) CalibrateRatings(c *fiber.Ctx) error {
+	dryRun := c.QueryBool("dry_run", false)
+
+	var report *models.CalibrationReport
+	var err error
+
+	if fileHeader, formErr := c.FormFile("file"); formErr == nil {
+		file, openErr := fileHeader.Open()
+		if openErr != nil {
+			return problem(c, http.StatusBadRequest, openErr.Error())
+		}
+		defer file.Close()
+
+		report, err = h.Calibrator.CalibrateFromCSV(c.UserContext(), file, dryRun)
+	} else if strings.HasPrefix(c.Get(fiber.HeaderContentType), "text/csv") {
+		report, err = h.Calibrator.CalibrateFromCSV(c.UserContext(), bytes.NewReader(c.Body()), dryRun)
+	} else {
+		report, err = h.Calibrator.CalibrateFromDatabase(c.UserContext(), dryRun)
+	}
+
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidHistoricalData) || errors.Is(err, services.ErrNotEnoughMatches) {
+			return problem(c, http.StatusBadRequest, err.Error())
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultRequestTimeout is the request deadline used when none is configured
+const DefaultRequestTimeout = 30 * time.Second
+
+// requestTimeoutLocal is the key of the request timeout in the request locals
+const requestTimeoutLocal = "request_timeout"
+
+// RequestTimeout gives every request a context that ends after timeout or when base ends,
+// so that database work and simulations stop with the request.
+// Handlers read it with c.UserContext().
+// The context does not end when the client disconnects: fasthttp, which Fiber runs on, does not
+// report a closed connection while a handler runs, so the deadline is what bounds abandoned work.
+func RequestTimeout(base context.Context, timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(base, timeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+		c.Locals(requestTimeoutLocal, timeout)
+
+		err := c.Next()
+
+		// Work cut short by the deadline surfaces as a server error; report it as a timeout instead
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && c.Response().StatusCode() == http.StatusInternalServerError {
+			return problem(c, http.StatusServiceUnavailable, fmt.Sprintf("The request did not finish within %s", timeout))
+		}
+		return err
+	}
+}
+
+// defaultSimulationTimeout bounds Monte Carlo simulations when the request gives no ?timeout=
+const defaultSimulationTimeout = 10 * time.Second
+
+// simulationContext returns the request's context with a deadline for Monte Carlo simulations,
+// taken from ?timeout= (such as "2s" or "500ms") or defaultSimulationTimeout.
+// A simulation cannot outlast its request, so ?timeout= may be at most the request timeout.
+// Simulations that reach the deadline return the runs finished so far.
+func simulationContext(c *fiber.Ctx) (context.Context, context.CancelFunc, error) {
+	maxTimeout := DefaultRequestTimeout
+	if requestTimeout, ok := c.Locals(requestTimeoutLocal).(time.Duration); ok {
+		maxTimeout = requestTimeout
+	}
+
+	timeout := defaultSimulationTimeout
+	if timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+	if value := c.Query("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > maxTimeout {
+			return nil, nil, fmt.Errorf("timeout must be a duration between 1ms and %s", maxTimeout)
+		}
+		timeout = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+	return ctx, cancel, nil
+}
+
+// isSimulationCancelled reports whether a simulation stopped before finishing a single run
+func isSimulationCancelled(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// simulationCancelledResponse responds to a simulation that stopped before finishing a single run
+func simulationCancelledResponse(c *fiber.Ctx) error {
+	return problem(c, http.StatusServiceUnavailable, "The simulation was cancelled before any run finished; try a longer timeout")
+}
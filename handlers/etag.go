@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errInvalidIfMatch is returned for an If-Match header that is not an ETag from this API
+var errInvalidIfMatch = errors.New(`If-Match must be "*" or an ETag from this API, such as "3"`)
+
+// setETag sets the ETag header to a team, match or league version
+func setETag(c *fiber.Ctx, version int) {
+	c.Set(fiber.HeaderETag, `"`+strconv.Itoa(version)+`"`)
+}
+
+// ifMatchVersion returns the version named by the If-Match header, or 0 when the header is absent or "*"
+func ifMatchVersion(c *fiber.Ctx) (int, error) {
+	tag := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if tag == "" || tag == "*" {
+		return 0, nil
+	}
+
+	// Weak tags never match for If-Match, and this API only hands out strong ones
+	if len(tag) < 3 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errInvalidIfMatch
+	}
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || version < 1 {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
+
+// versionConflict responds with a 409 for an update based on an outdated version
+func versionConflict(c *fiber.Ctx) error {
+	return problem(c, http.StatusConflict, "The resource was changed by someone else; fetch it again and retry")
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// ExperimentHandler handles batch season simulation requests
+type ExperimentHandler struct {
+	Runner *services.ExperimentRunner
+}
+
+// NewExperimentHandler creates a new ExperimentHandler
+func NewExperimentHandler(runner *services.ExperimentRunner) *ExperimentHandler {
+	return &ExperimentHandler{
+		Runner: runner,
+	}
+}
+
+// RunExperiment simulates many complete seasons from week 1 and returns the aggregated report.
+// The league itself is not changed.
+func (h *ExperimentHandler) RunExperiment(c *fiber.Ctx) error {
+	config := new(models.ExperimentConfig)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(config); err != nil {
+			return problem(c, http.StatusBadRequest, err.Error())
+		}
+	}
+
+	report, err := h.Runner.Run(c.UserContext(), config)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidExperiment) {
+			return problem(c, http.StatusBadRequest, err.Error())
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// Media types offered by the export endpoints
+const (
+	mimeTextCSV    = "text/csv"
+	mimeExcelSheet = "application/vnd.ms-excel"
+)
+
+// ExportHandler handles exports of league data
+type ExportHandler struct {
+	Exporter *services.Exporter
+}
+
+// NewExportHandler creates a new ExportHandler
+func NewExportHandler(exporter *services.Exporter) *ExportHandler {
+	return &ExportHandler{
+		Exporter: exporter,
+	}
+}
+
+// ExportTable exports the current league table
+func (h *ExportHandler) ExportTable(c *fiber.Ctx) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+
+	table, err := h.Exporter.Table(c.UserContext())
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	setExportHeaders(c, "league-table", format)
+	return services.WriteTable(c, format, table)
+}
+
+// ExportMatches exports all matches with their scores
+func (h *ExportHandler) ExportMatches(c *fiber.Ctx) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+
+	matches, err := h.Exporter.Matches(c.UserContext())
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	setExportHeaders(c, "matches", format)
+	return services.WriteMatches(c, format, matches)
+}
+
+// ExportPrediction exports the predicted final table
+func (h *ExportHandler) ExportPrediction(c *fiber.Ctx) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+
+	table, err := h.Exporter.Prediction(c.UserContext())
+	if err != nil {
+		if errors.Is(err, services.ErrPredictionsUnavailable) {
+			return problem(c, http.StatusBadRequest, err.Error())
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	setExportHeaders(c, "prediction", format)
+	return services.WriteTable(c, format, table)
+}
+
+// ExportSnapshot exports the whole league as a JSON snapshot that POST /api/import/snapshot restores
+func (h *ExportHandler) ExportSnapshot(c *fiber.Ctx) error {
+	snapshot, err := h.Exporter.Snapshot(c.UserContext())
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	setExportHeaders(c, "league-snapshot", models.FormatJSON)
+	return c.JSON(snapshot)
+}
+
+// exportFormat returns the format named by ?format=, or else the best match for the Accept header, defaulting to JSON
+func exportFormat(c *fiber.Ctx) (string, error) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		switch c.Accepts(fiber.MIMEApplicationJSON, mimeTextCSV, mimeExcelSheet) {
+		case mimeTextCSV:
+			format = models.FormatCSV
+		case mimeExcelSheet:
+			format = models.FormatExcel
+		default:
+			format = models.FormatJSON
+		}
+	}
+	return format, services.CheckExportFormat(format)
+}
+
+// setExportHeaders sets the content type and a download file name for an export
+func setExportHeaders(c *fiber.Ctx, name, format string) {
+	if format == models.FormatJSON {
+		c.Attachment(name + ".json")
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		return
+	}
+	c.Attachment(name + ".csv")
+	c.Set(fiber.HeaderContentType, mimeTextCSV+"; charset=utf-8")
+}
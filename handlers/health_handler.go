@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// readinessTimeout bounds the readiness check so a stuck database fails the probe instead of hanging it
+const readinessTimeout = 2 * time.Second
+
+// HealthHandler handles the liveness and readiness probes of the hosting platform
+type HealthHandler struct {
+	// Ready checks the dependencies the server needs, such as the database and its schema
+	Ready func(ctx context.Context) error
+}
+
+// NewHealthHandler creates a new HealthHandler
+func NewHealthHandler(ready func(ctx context.Context) error) *HealthHandler {
+	return &HealthHandler{
+		Ready: ready,
+	}
+}
+
+// Healthz reports that the process is up
+func (h *HealthHandler) Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// Readyz reports whether the server can handle requests
+func (h *HealthHandler) Readyz(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), readinessTimeout)
+	defer cancel()
+	if err := h.Ready(ctx); err != nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "unavailable",
+			"error":  err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "ready",
+	})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// DefaultIdempotencyWindow is how long idempotency keys are kept when no window is configured
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// idempotencyReplayedHeader marks a response replayed from an earlier request with the same key
+const idempotencyReplayedHeader = "Idempotent-Replayed"
+
+// IdempotencyHandler replays the responses of POST and PUT requests repeated with the same Idempotency-Key
+type IdempotencyHandler struct {
+	Repo   services.IdempotencyRepository
+	Window time.Duration
+	// Lease bounds how long an unfinished request holds its key, so that a key whose request died,
+	// for example with its instance, is not blocked for the whole window
+	Lease time.Duration
+}
+
+// NewIdempotencyHandler creates a new IdempotencyHandler that keeps keys for window and lets
+// a request hold its key for lease
+func NewIdempotencyHandler(repo services.IdempotencyRepository, window, lease time.Duration) *IdempotencyHandler {
+	return &IdempotencyHandler{
+		Repo:   repo,
+		Window: window,
+		Lease:  lease,
+	}
+}
+
+// Middleware runs a POST or PUT with an Idempotency-Key header at most once per tenant and key.
+// A repeat of a successful request gets the stored response; a failed request releases its key so it can be retried.
+// Keys are bound to the request they were first used with, so reusing one for a different request is rejected.
+func (h *IdempotencyHandler) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost && c.Method() != fiber.MethodPut {
+			return c.Next()
+		}
+		key := c.Get(models.IdempotencyKeyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > models.MaxIdempotencyKeyLength {
+			return problem(c, http.StatusBadRequest, fmt.Sprintf("%s must be at most %d characters", models.IdempotencyKeyHeader, models.MaxIdempotencyKeyLength))
+		}
+
+		tenantID := currentWorkspace(c).Tenant.ID
+		hash := requestHash(c)
+		record, reserved, err := h.Repo.Reserve(c.UserContext(), &models.IdempotencyRecord{
+			TenantID:    tenantID,
+			Key:         key,
+			RequestHash: hash,
+		}, h.Window, h.Lease)
+		if err != nil {
+			return problem(c, http.StatusInternalServerError, err.Error())
+		}
+
+		if !reserved {
+			switch {
+			case record.RequestHash != hash:
+				return problem(c, http.StatusUnprocessableEntity, "This "+models.IdempotencyKeyHeader+" was already used for a different request")
+			case !record.Completed:
+				return problem(c, http.StatusConflict, "A request with this "+models.IdempotencyKeyHeader+" is still running")
+			}
+			return replay(c, record)
+		}
+
+		// Unless the response is stored, the key is released however the handler ends, so it can be retried.
+		// The request's context may have ended with it, so the key is settled in a context of its own.
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := h.Repo.Release(ctx, record); err != nil {
+				log.Printf("Releasing idempotency key %q: %v", key, err)
+			}
+		}()
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		status := c.Response().StatusCode()
+		if status < http.StatusOK || status >= http.StatusMultipleChoices {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		record.Completed = true
+		record.Status = status
+		record.ContentType = string(c.Response().Header.ContentType())
+		record.ETag = string(c.Response().Header.Peek(fiber.HeaderETag))
+		record.Body = append([]byte(nil), c.Response().Body()...)
+		if err := h.Repo.Complete(ctx, record); err != nil {
+			log.Printf("Storing the response for idempotency key %q: %v", key, err)
+			return nil
+		}
+		completed = true
+		return nil
+	}
+}
+
+// requestHash fingerprints the parts of a request that must match for its key to be reused:
+// the method, path and query, body and credentials
+func requestHash(c *fiber.Ctx) string {
+	hash := sha256.New()
+	for _, part := range [][]byte{
+		[]byte(c.Method()),
+		[]byte(c.OriginalURL()),
+		c.Body(),
+		[]byte(c.Get("X-API-Key")),
+		[]byte(c.Get(fiber.HeaderAuthorization)),
+	} {
+		// Each part is length-prefixed so that moving bytes between parts changes the hash
+		fmt.Fprintf(hash, "%d:", len(part))
+		hash.Write(part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replay responds with the stored response of an earlier request
+func replay(c *fiber.Ctx, record *models.IdempotencyRecord) error {
+	c.Set(idempotencyReplayedHeader, "true")
+	if record.ContentType != "" {
+		c.Set(fiber.HeaderContentType, record.ContentType)
+	}
+	if record.ETag != "" {
+		c.Set(fiber.HeaderETag, record.ETag)
+	}
+	return c.Status(record.Status).Send(record.Body)
+}
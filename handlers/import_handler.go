@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// ImportHandler handles team and fixture imports
+type ImportHandler struct {
+	Importer *services.Importer
+}
+
+// NewImportHandler creates a new ImportHandler
+func NewImportHandler(importer *services.Importer) *ImportHandler {
+	return &ImportHandler{
+		Importer: importer,
+	}
+}
+
+// ImportTeams imports teams from an uploaded CSV or JSON file
+func (h *ImportHandler) ImportTeams(c *fiber.Ctx) error {
+	return h.runImport(c, h.Importer.ImportTeams)
+}
+
+// ImportFixtures imports fixtures from an uploaded CSV or JSON file
+func (h *ImportHandler) ImportFixtures(c *fiber.Ctx) error {
+	return h.runImport(c, h.Importer.ImportFixtures)
+}
+
+// ImportSnapshot replaces the tenant's league with a JSON snapshot from GET /api/export/snapshot.
+// Add ?dry_run=true to only check the snapshot.
+func (h *ImportHandler) ImportSnapshot(c *fiber.Ctx) error {
+	report, err := h.Importer.ImportSnapshot(c.UserContext(), bytes.NewReader(c.Body()), c.QueryBool("dry_run", false))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidImportFile) {
+			return problem(c, http.StatusBadRequest, err.Error())
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(report)
+}
+
+// runImport reads the import file from the "file" form field or the request body and runs the import.
+// The format comes from ?format=, the file extension or the Content-Type header. Add ?dry_run=true to only validate.
+func (h *ImportHandler) runImport(c *fiber.Ctx, importFn func(ctx context.Context, format string, r io.Reader, dryRun bool) (*models.ImportReport, error)) error {
+	dryRun := c.QueryBool("dry_run", false)
+	format := strings.ToLower(c.Query("format"))
+
+	var body io.Reader
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return problem(c, http.StatusBadRequest, err.Error())
+		}
+		defer file.Close()
+
+		body = file
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+		}
+	} else {
+		body = bytes.NewReader(c.Body())
+		if format == "" {
+			format = formatFromContentType(c.Get(fiber.HeaderContentType))
+		}
+	}
+
+	report, err := importFn(c.UserContext(), format, body, dryRun)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedFormat) || errors.Is(err, services.ErrInvalidImportFile) {
+			return problem(c, http.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, models.ErrDuplicateTeamName) {
+			return problem(c, http.StatusConflict, err.Error())
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	switch {
+	case len(report.Errors) > 0:
+		return c.Status(http.StatusUnprocessableEntity).JSON(report)
+	case dryRun:
+		return c.JSON(report)
+	}
+	return c.Status(http.StatusCreated).JSON(report)
+}
+
+// formatFromContentType maps a Content-Type header to a data format
+func formatFromContentType(contentType string) string {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "json"):
+		return models.FormatJSON
+	case strings.Contains(contentType, "csv"):
+		return models.FormatCSV
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// JobHandler handles background job requests
+type JobHandler struct {
+	Service *services.JobService
+}
+
+// NewJobHandler creates a new JobHandler
+func NewJobHandler(service *services.JobService) *JobHandler {
+	return &JobHandler{
+		Service: service,
+	}
+}
+
+// GetAllJobs returns the most recent jobs
+func (h *JobHandler) GetAllJobs(c *fiber.Ctx) error {
+	jobs, err := h.Service.List(c.UserContext())
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(jobs)
+}
+
+// GetJob returns a job's status and progress, and its result once it has finished
+func (h *JobHandler) GetJob(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid job ID")
+	}
+
+	job, err := h.Service.Get(c.UserContext(), id)
+	if err != nil {
+		return jobError(c, err)
+	}
+
+	return c.JSON(job)
+}
+
+// CreateJob queues a job and responds with 202 and its ID straight away; poll GET /api/jobs/:id for the outcome.
+// Prediction and experiment jobs are public, like the endpoints they stand in for; jobs that change the league need the editor role.
+func (h *JobHandler) CreateJob(c *fiber.Ctx) error {
+	request := new(models.JobRequest)
+	if err := c.BodyParser(request); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+
+	if request.Type == models.JobSimulateRemaining && !hasRole(c, models.RoleEditor) {
+		return missingRole(c, models.RoleEditor)
+	}
+
+	job, err := h.Service.Submit(c.UserContext(), request)
+	if err != nil {
+		return jobError(c, err)
+	}
+
+	c.Location("/api/jobs/" + strconv.Itoa(job.ID))
+	return c.Status(http.StatusAccepted).JSON(job)
+}
+
+// CancelJob cancels a queued job, or asks a running one to stop. A cancelled prediction keeps the runs finished so far.
+// Jobs that change the league need the editor role to cancel, as they do to create.
+func (h *JobHandler) CancelJob(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid job ID")
+	}
+
+	job, err := h.Service.Get(c.UserContext(), id)
+	if err != nil {
+		return jobError(c, err)
+	}
+	if job.Type == models.JobSimulateRemaining && !hasRole(c, models.RoleEditor) {
+		return missingRole(c, models.RoleEditor)
+	}
+
+	job, err = h.Service.Cancel(c.UserContext(), id)
+	if err != nil {
+		return jobError(c, err)
+	}
+
+	return c.Status(http.StatusAccepted).JSON(job)
+}
+
+// hasRole returns true if the request's API key has at least the given role
+func hasRole(c *fiber.Ctx, role string) bool {
+	apiKey, ok := c.Locals(apiKeyLocal).(*models.APIKey)
+	return ok && apiKey.HasRole(role)
+}
+
+// missingRole responds to a request without the given role: 401 without an API key and 403 with one
+func missingRole(c *fiber.Ctx, role string) error {
+	if _, ok := c.Locals(apiKeyLocal).(*models.APIKey); !ok {
+		return problem(c, http.StatusUnauthorized, "API key required")
+	}
+	return problem(c, http.StatusForbidden, "This action requires the "+role+" role")
+}
+
+// jobError maps job service errors to problem responses
+func jobError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		return problem(c, http.StatusNotFound, "Job not found")
+	case errors.Is(err, services.ErrInvalidJob):
+		return problem(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrJobFinished):
+		return problem(c, http.StatusConflict, err.Error())
+	}
+	return problem(c, http.StatusInternalServerError, err.Error())
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"sort"
 
@@ -9,117 +10,117 @@ import (
 	"github.com/user/footballsim/services"
 )
 
+const (
+	// earlySeasonProgress is the share of the season below which predictions carry confidence intervals
+	earlySeasonProgress = 0.5
+	// confidenceRuns is the number of simulated seasons used for prediction confidence intervals
+	confidenceRuns = 1000
+)
+
 // LeagueHandler handles league related requests
 type LeagueHandler struct {
 	LeagueRepo services.LeagueRepository
 	TeamRepo   services.TeamRepository
 	MatchRepo  services.MatchRepository
 	Predictor  services.Predictor
+	Outlook    *services.OutlookAnalyzer
+	Service    *services.LeagueService
+	Lock       services.LeagueLock
 }
 
 // NewLeagueHandler creates a new LeagueHandler
-func NewLeagueHandler(leagueRepo services.LeagueRepository, teamRepo services.TeamRepository, matchRepo services.MatchRepository, predictor services.Predictor) *LeagueHandler {
+func NewLeagueHandler(leagueRepo services.LeagueRepository, teamRepo services.TeamRepository, matchRepo services.MatchRepository, predictor services.Predictor, outlook *services.OutlookAnalyzer, service *services.LeagueService, lock services.LeagueLock) *LeagueHandler {
 	return &LeagueHandler{
 		LeagueRepo: leagueRepo,
 		TeamRepo:   teamRepo,
 		MatchRepo:  matchRepo,
 		Predictor:  predictor,
+		Outlook:    outlook,
+		Service:    service,
+		Lock:       lock,
 	}
 }
 
 // GetCurrentLeague returns the current league
 func (h *LeagueHandler) GetCurrentLeague(c *fiber.Ctx) error {
-	league, err := h.LeagueRepo.GetCurrent()
+	league, err := h.LeagueRepo.GetCurrent(c.UserContext())
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
+	setETag(c, league.Version)
 	return c.JSON(league)
 }
 
-// CreateLeague creates a new league
+// CreateLeague creates a new league starting at week 1
 func (h *LeagueHandler) CreateLeague(c *fiber.Ctx) error {
-	league := new(models.League)
-	if err := c.BodyParser(league); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	request := new(models.LeagueRequest)
+	if err := c.BodyParser(request); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+	if errs := request.Validate(); len(errs) > 0 {
+		return validationProblem(c, errs)
 	}
 
-	if err := h.LeagueRepo.Create(league); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	league := request.League()
+	if err := h.LeagueRepo.Create(c.UserContext(), league); err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
+	setETag(c, league.Version)
 	return c.Status(http.StatusCreated).JSON(league)
 }
 
-// ResetLeague resets the current league to the beginning
-func (h *LeagueHandler) ResetLeague(c *fiber.Ctx) error {
-	// Get current league
-	league, err := h.LeagueRepo.GetCurrent()
+// UpdatePredictionRule changes when predictions become available for the current league.
+// With an If-Match header the league must still be at that version.
+func (h *LeagueHandler) UpdatePredictionRule(c *fiber.Ctx) error {
+	version, err := ifMatchVersion(c)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem(c, http.StatusBadRequest, err.Error())
 	}
 
-	// Reset all teams
-	teams, err := h.TeamRepo.GetAll()
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-
-	for _, team := range teams {
-		team.Played = 0
-		team.Won = 0
-		team.Drawn = 0
-		team.Lost = 0
-		team.GoalsFor = 0
-		team.GoalsAgainst = 0
-		team.GoalDifference = 0
-		team.Points = 0
-
-		if err := h.TeamRepo.Update(team); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		}
+	request := new(models.PredictionRuleRequest)
+	if err := c.BodyParser(request); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+	if errs := request.Validate(); len(errs) > 0 {
+		return validationProblem(c, errs)
 	}
 
-	// Reset all matches
-	matches, err := h.MatchRepo.GetAll()
+	league, err := h.LeagueRepo.GetCurrent(c.UserContext())
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+	if version != 0 && version != league.Version {
+		return versionConflict(c)
 	}
 
-	for _, match := range matches {
-		match.HomeTeamGoals = 0
-		match.AwayTeamGoals = 0
-		match.Played = false
-		match.IsEdited = false
-
-		if err := h.MatchRepo.Update(match); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+	league.PredictionRule = request.PredictionRule
+	league.PredictionThreshold = request.PredictionThreshold
+	if err := h.LeagueRepo.Update(c.UserContext(), league); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			return versionConflict(c)
 		}
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
-	// Reset league to week 1
-	league.CurrentWeek = 1
-	league.IsCompleted = false
-	if err := h.LeagueRepo.Update(league); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	setETag(c, league.Version)
+	return c.JSON(league)
+}
+
+// ResetLeague resets the current league to the beginning
+func (h *LeagueHandler) ResetLeague(c *fiber.Ctx) error {
+	unlock, err := h.Lock.Lock(c.UserContext())
+	if err != nil {
+		return leagueLockError(c, err)
+	}
+	defer unlock()
+
+	if err := h.Service.Reset(c.UserContext()); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			return versionConflict(c)
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
 	return c.JSON(fiber.Map{
@@ -127,53 +128,51 @@ func (h *LeagueHandler) ResetLeague(c *fiber.Ctx) error {
 	})
 }
 
-// GetLeagueTable returns the current league table
+// GetLeagueTable returns the current league table, or another ?view of it such as home, away or form
 func (h *LeagueHandler) GetLeagueTable(c *fiber.Ctx) error {
+	view := c.Query("view", models.TableViewOverall)
+	formMatches := c.QueryInt("last", models.DefaultFormMatches)
+	if formMatches < 1 {
+		return problem(c, http.StatusBadRequest, "Invalid last value")
+	}
+	topN := c.QueryInt("top", services.DefaultTopN)
+	if topN < 1 {
+		return problem(c, http.StatusBadRequest, "Invalid top value")
+	}
+
 	// Get current league
-	league, err := h.LeagueRepo.GetCurrent()
+	league, err := h.LeagueRepo.GetCurrent(c.UserContext())
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
-	// Get all teams
-	teams, err := h.TeamRepo.GetAll()
+	// Get the sorted table
+	teamStats, err := h.Service.TableView(c.UserContext(), view, formMatches)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-
-	// Convert to TeamStats
-	teamStats := make([]*models.TeamStats, len(teams))
-	for i, team := range teams {
-		teamStats[i] = &models.TeamStats{
-			TeamID:         team.ID,
-			TeamName:       team.Name,
-			Played:         team.Played,
-			Won:            team.Won,
-			Drawn:          team.Drawn,
-			Lost:           team.Lost,
-			GoalsFor:       team.GoalsFor,
-			GoalsAgainst:   team.GoalsAgainst,
-			GoalDifference: team.GoalDifference,
-			Points:         team.Points,
+		if errors.Is(err, services.ErrInvalidTableView) {
+			return problem(c, http.StatusBadRequest, err.Error())
 		}
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
-	// Sort the teams by points, then goal difference, then goals for
-	sort.Slice(teamStats, func(i, j int) bool {
-		if teamStats[i].Points != teamStats[j].Points {
-			return teamStats[i].Points > teamStats[j].Points
+	// Mark clinched and eliminated teams; these only apply to the overall table
+	if view == models.TableViewOverall {
+		outlooks, err := h.Outlook.Analyze(c.UserContext(), topN)
+		if err != nil {
+			return problem(c, http.StatusInternalServerError, err.Error())
 		}
-		if teamStats[i].GoalDifference != teamStats[j].GoalDifference {
-			return teamStats[i].GoalDifference > teamStats[j].GoalDifference
+
+		statuses := make(map[int]string)
+		for _, outlook := range outlooks {
+			statuses[outlook.TeamID] = outlook.Status()
 		}
-		return teamStats[i].GoalsFor > teamStats[j].GoalsFor
-	})
+		for _, stats := range teamStats {
+			stats.Status = statuses[stats.TeamID]
+		}
+	}
 
 	leagueTable := &models.LeagueTable{
+		View:        view,
 		Teams:       teamStats,
 		CurrentWeek: league.CurrentWeek,
 		TotalWeeks:  league.TotalWeeks,
@@ -183,29 +182,40 @@ func (h *LeagueHandler) GetLeagueTable(c *fiber.Ctx) error {
 	return c.JSON(leagueTable)
 }
 
-// GetPrediction returns the predicted final league table after week 4
+// GetOutlook returns the points and position bounds of every team, with clinches and eliminations
+func (h *LeagueHandler) GetOutlook(c *fiber.Ctx) error {
+	topN := c.QueryInt("top", services.DefaultTopN)
+	if topN < 1 {
+		return problem(c, http.StatusBadRequest, "Invalid top value")
+	}
+
+	outlooks, err := h.Outlook.Analyze(c.UserContext(), topN)
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"outlook": outlooks,
+	})
+}
+
+// GetPrediction returns the predicted final league table once the league's prediction rule allows it
 func (h *LeagueHandler) GetPrediction(c *fiber.Ctx) error {
 	// Get current league
-	league, err := h.LeagueRepo.GetCurrent()
+	league, err := h.LeagueRepo.GetCurrent(c.UserContext())
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
-	// Check if we're at least at week 4
-	if league.CurrentWeek < 4 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Predictions are only available after week 4",
-		})
+	// Check the league's prediction availability rule
+	if !league.PredictionsAvailable() {
+		return problem(c, http.StatusBadRequest, league.PredictionUnavailableReason())
 	}
 
 	// Get prediction
-	predictedTable, err := h.Predictor.PredictFinalTable()
+	predictedTable, err := h.Predictor.PredictFinalTable(c.UserContext())
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
 	// Sort the teams by points, then goal difference, then goals for (just to be sure)
@@ -219,8 +229,28 @@ func (h *LeagueHandler) GetPrediction(c *fiber.Ctx) error {
 		return predictedTable[i].GoalsFor > predictedTable[j].GoalsFor
 	})
 
-	// Always return with the expected structure: {"prediction": [...]}
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"prediction": predictedTable,
-	})
+	}
+
+	// Early in the season a single run says little, so add intervals from many runs
+	if league.SeasonProgress() < earlySeasonProgress {
+		ctx, cancel, err := simulationContext(c)
+		if err != nil {
+			return problem(c, http.StatusBadRequest, err.Error())
+		}
+		defer cancel()
+
+		distribution, err := h.Predictor.PredictDistribution(ctx, nil, confidenceRuns)
+		if err != nil {
+			if isSimulationCancelled(err) {
+				return simulationCancelledResponse(c)
+			}
+			return problem(c, http.StatusInternalServerError, err.Error())
+		}
+		response["confidence"] = distribution
+	}
+
+	// Always return the prediction under the expected key: {"prediction": [...]}
+	return c.JSON(response)
 } 
\ No newline at end of file
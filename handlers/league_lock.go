@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+)
+
+// leagueBusyRetryAfter is the Retry-After, in seconds, sent while the league is busy
+const leagueBusyRetryAfter = "2"
+
+// leagueLockError responds to a failure to take the league lock. Simulations are refused
+// while the league is busy; resets and result edits wait for it until their deadline.
+func leagueLockError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, models.ErrLeagueBusy) {
+		c.Set(fiber.HeaderRetryAfter, leagueBusyRetryAfter)
+		return problem(c, http.StatusConflict, "Another simulation, reset or result edit is running for this league; try again when it has finished")
+	}
+	return problem(c, http.StatusInternalServerError, err.Error())
+}
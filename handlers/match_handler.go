@@ -1,10 +1,19 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/metrics"
+	"github.com/user/footballsim/models"
 	"github.com/user/footballsim/services"
 	"log"
 )
@@ -14,47 +23,70 @@ type MatchHandler struct {
 	MatchRepo services.MatchRepository
 	TeamRepo  services.TeamRepository
 	Simulator services.Simulator
+	Odds      *services.OddsCalculator
+	Lock      services.LeagueLock
+	Tx        services.Transactor
 }
 
 // NewMatchHandler creates a new MatchHandler
-func NewMatchHandler(matchRepo services.MatchRepository, teamRepo services.TeamRepository, simulator services.Simulator) *MatchHandler {
+func NewMatchHandler(matchRepo services.MatchRepository, teamRepo services.TeamRepository, simulator services.Simulator, odds *services.OddsCalculator, lock services.LeagueLock, tx services.Transactor) *MatchHandler {
 	return &MatchHandler{
 		MatchRepo: matchRepo,
 		TeamRepo:  teamRepo,
 		Simulator: simulator,
+		Odds:      odds,
+		Lock:      lock,
+		Tx:        tx,
 	}
 }
 
-// GetAllMatches returns all matches
+// GetAllMatches returns one page of the matches selected by the query's filters,
+// with the total in X-Total-Count and the neighbouring pages in Link
 func (h *MatchHandler) GetAllMatches(c *fiber.Ctx) error {
-	matches, err := h.MatchRepo.GetAll()
+	filter, errs := parseMatchFilter(c)
+	if len(errs) > 0 {
+		return validationProblem(c, errs)
+	}
+
+	matches, total, err := h.MatchRepo.Find(c.UserContext(), filter)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
+	setPageHeaders(c, filter.Page, filter.PageSize, total)
 	return c.JSON(matches)
 }
 
+// GetMatchByID returns a match by ID, with its version as the ETag
+func (h *MatchHandler) GetMatchByID(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid match ID")
+	}
+
+	match, err := h.MatchRepo.GetByID(c.UserContext(), id)
+	if err != nil {
+		return problem(c, http.StatusNotFound, "Match not found")
+	}
+
+	setETag(c, match.Version)
+	return c.JSON(match)
+}
+
 // GetMatchesByWeek returns matches for a specific week
 func (h *MatchHandler) GetMatchesByWeek(c *fiber.Ctx) error {
 	week, err := strconv.Atoi(c.Params("week"))
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid week number",
-		})
+		return problem(c, http.StatusBadRequest, "Invalid week number")
 	}
 
 	// Debug logging
 	log.Printf("Getting matches for week %d", week)
 	
-	matches, err := h.MatchRepo.GetByWeek(week)
+	matches, err := h.MatchRepo.GetByWeek(c.UserContext(), week)
 	if err != nil {
 		log.Printf("Error getting matches for week %d: %v", week, err)
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
 	log.Printf("Found %d matches for week %d", len(matches), week)
@@ -65,24 +97,56 @@ func (h *MatchHandler) GetMatchesByWeek(c *fiber.Ctx) error {
 	})
 }
 
+// GetMatchOdds returns the outcome probabilities and scoreline distribution of an unplayed match
+func (h *MatchHandler) GetMatchOdds(c *fiber.Ctx) error {
+	matchID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid match ID")
+	}
+
+	match, err := h.MatchRepo.GetByID(c.UserContext(), matchID)
+	if err != nil {
+		return problem(c, http.StatusNotFound, "Match not found")
+	}
+
+	odds, err := h.Odds.MatchOdds(c.UserContext(), match)
+	if err != nil {
+		if errors.Is(err, services.ErrMatchAlreadyPlayed) {
+			return problem(c, http.StatusBadRequest, "Odds are only available for unplayed matches")
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(odds)
+}
+
 // SimulateWeek simulates all matches for a specific week
 func (h *MatchHandler) SimulateWeek(c *fiber.Ctx) error {
 	week, err := strconv.Atoi(c.Params("week"))
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid week number",
-		})
+		return problem(c, http.StatusBadRequest, "Invalid week number")
+	}
+
+	// Overlapping runs could simulate the same matches twice or advance the week twice
+	unlock, err := h.Lock.TryLock(c.UserContext())
+	if err != nil {
+		return leagueLockError(c, err)
 	}
+	defer unlock()
 
 	// Debug logging
 	log.Printf("Simulating matches for week %d", week)
 	
-	playedMatches, err := h.Simulator.SimulateWeek(week)
+	playedMatches, err := h.Simulator.SimulateWeek(c.UserContext(), week)
 	if err != nil {
 		log.Printf("Error simulating week %d: %v", week, err)
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		if errors.Is(err, services.ErrInvalidWeek) {
+			return problem(c, http.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, models.ErrVersionConflict) {
+			return versionConflict(c)
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
 	log.Printf("Successfully simulated %d matches for week %d", len(playedMatches), week)
@@ -95,15 +159,22 @@ func (h *MatchHandler) SimulateWeek(c *fiber.Ctx) error {
 
 // SimulateAllRemainingMatches simulates all remaining matches in the league
 func (h *MatchHandler) SimulateAllRemainingMatches(c *fiber.Ctx) error {
+	unlock, err := h.Lock.TryLock(c.UserContext())
+	if err != nil {
+		return leagueLockError(c, err)
+	}
+	defer unlock()
+
 	// Debug logging
 	log.Printf("Simulating all remaining matches")
 	
-	playedMatches, err := h.Simulator.SimulateRemaining()
+	playedMatches, err := h.Simulator.SimulateRemaining(c.UserContext())
 	if err != nil {
 		log.Printf("Error simulating all remaining matches: %v", err)
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		if errors.Is(err, models.ErrVersionConflict) {
+			return versionConflict(c)
+		}
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
 	log.Printf("Successfully simulated %d remaining matches", len(playedMatches))
@@ -113,123 +184,212 @@ func (h *MatchHandler) SimulateAllRemainingMatches(c *fiber.Ctx) error {
 	})
 }
 
-// UpdateMatchResult updates the result of a match
+// UpdateMatchResult updates the result of a match and the standings of both teams, in one transaction.
+// With an If-Match header the match must still be at that version.
 func (h *MatchHandler) UpdateMatchResult(c *fiber.Ctx) error {
 	matchID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid match ID",
-		})
+		return problem(c, http.StatusBadRequest, "Invalid match ID")
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
 	}
 
-	var updateData struct {
-		HomeTeamGoals int `json:"home_team_goals"`
-		AwayTeamGoals int `json:"away_team_goals"`
+	request := new(models.MatchResultRequest)
+	if err := c.BodyParser(request); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+	if errs := request.Validate(); len(errs) > 0 {
+		return validationProblem(c, errs)
 	}
 
-	if err := c.BodyParser(&updateData); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	// Wait for any simulation or other edit, so the standings are not changed underneath it
+	unlock, err := h.Lock.Lock(c.UserContext())
+	if err != nil {
+		return leagueLockError(c, err)
 	}
+	defer unlock()
 
 	// Get match
-	match, err := h.MatchRepo.GetByID(matchID)
+	match, err := h.MatchRepo.GetByID(c.UserContext(), matchID)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{
-			"error": "Match not found",
-		})
+		return problem(c, http.StatusNotFound, "Match not found")
+	}
+	if version != 0 && version != match.Version {
+		return versionConflict(c)
 	}
 
 	// Get teams
-	homeTeam, err := h.TeamRepo.GetByID(match.HomeTeamID)
-	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{
-			"error": "Home team not found",
-		})
-	}
-
-	awayTeam, err := h.TeamRepo.GetByID(match.AwayTeamID)
-	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{
-			"error": "Away team not found",
-		})
-	}
-
-	// If match was already played, revert the old result
-	if match.Played {
-		// Revert home team stats
-		homeTeam.Played--
-		homeTeam.GoalsFor -= match.HomeTeamGoals
-		homeTeam.GoalsAgainst -= match.AwayTeamGoals
-
-		// Revert away team stats
-		awayTeam.Played--
-		awayTeam.GoalsFor -= match.AwayTeamGoals
-		awayTeam.GoalsAgainst -= match.HomeTeamGoals
-
-		// Revert wins, draws, losses
-		if match.HomeTeamGoals > match.AwayTeamGoals {
-			homeTeam.Won--
-			awayTeam.Lost--
-		} else if match.HomeTeamGoals < match.AwayTeamGoals {
-			homeTeam.Lost--
-			awayTeam.Won--
-		} else {
-			homeTeam.Drawn--
-			awayTeam.Drawn--
-		}
+	homeTeam, err := h.TeamRepo.GetByID(c.UserContext(), match.HomeTeamID)
+	if err != nil {
+		return problem(c, http.StatusNotFound, "Home team not found")
 	}
 
+	awayTeam, err := h.TeamRepo.GetByID(c.UserContext(), match.AwayTeamID)
+	if err != nil {
+		return problem(c, http.StatusNotFound, "Away team not found")
+	}
+
+	// Keep the old result so it can be reverted from the standings
+	oldMatch := *match
+
 	// Update match result
-	match.HomeTeamGoals = updateData.HomeTeamGoals
-	match.AwayTeamGoals = updateData.AwayTeamGoals
+	match.HomeTeamGoals = *request.HomeTeamGoals
+	match.AwayTeamGoals = *request.AwayTeamGoals
 	match.Played = true
 	match.IsEdited = true
 
-	// Update teams with new result
-	homeTeam.Played++
-	homeTeam.GoalsFor += match.HomeTeamGoals
-	homeTeam.GoalsAgainst += match.AwayTeamGoals
-
-	awayTeam.Played++
-	awayTeam.GoalsFor += match.AwayTeamGoals
-	awayTeam.GoalsAgainst += match.HomeTeamGoals
-
-	// Update wins, draws, losses
-	if match.HomeTeamGoals > match.AwayTeamGoals {
-		homeTeam.Won++
-		awayTeam.Lost++
-	} else if match.HomeTeamGoals < match.AwayTeamGoals {
-		homeTeam.Lost++
-		awayTeam.Won++
+	// Move the teams' standings from the old result to the new one. The change is reapplied
+	// to the latest standings when a team is updated concurrently, for example by a simulation.
+	homeChange := func(team *models.Team) {
+		if oldMatch.Played {
+			revertTeamResult(team, oldMatch.HomeTeamGoals, oldMatch.AwayTeamGoals)
+		}
+		applyTeamResult(team, match.HomeTeamGoals, match.AwayTeamGoals)
+	}
+	awayChange := func(team *models.Team) {
+		if oldMatch.Played {
+			revertTeamResult(team, oldMatch.AwayTeamGoals, oldMatch.HomeTeamGoals)
+		}
+		applyTeamResult(team, match.AwayTeamGoals, match.HomeTeamGoals)
+	}
+
+	// The match and both teams change together or not at all; the match update fails when
+	// someone else changed the match since it was read
+	err = h.Tx.InTx(c.UserContext(), func(ctx context.Context) error {
+		if err := h.MatchRepo.Update(ctx, match); err != nil {
+			return err
+		}
+		if err := services.ApplyTeamChange(ctx, h.TeamRepo, homeTeam, homeChange); err != nil {
+			return err
+		}
+		return services.ApplyTeamChange(ctx, h.TeamRepo, awayTeam, awayChange)
+	})
+	switch {
+	case errors.Is(err, models.ErrVersionConflict):
+		return versionConflict(c)
+	case errors.Is(err, sql.ErrNoRows):
+		return problem(c, http.StatusNotFound, "Match not found")
+	case err != nil:
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+	metrics.ResultsEdited.Inc()
+
+	setETag(c, match.Version)
+	return c.JSON(match)
+}
+
+// applyTeamResult adds a result to a team's standings
+func applyTeamResult(team *models.Team, goalsFor, goalsAgainst int) {
+	team.Played++
+	team.GoalsFor += goalsFor
+	team.GoalsAgainst += goalsAgainst
+	if goalsFor > goalsAgainst {
+		team.Won++
+	} else if goalsFor < goalsAgainst {
+		team.Lost++
 	} else {
-		homeTeam.Drawn++
-		awayTeam.Drawn++
+		team.Drawn++
 	}
+	team.UpdateStats()
+}
 
-	// Update team stats
-	homeTeam.UpdateStats()
-	awayTeam.UpdateStats()
+// revertTeamResult removes a result from a team's standings
+func revertTeamResult(team *models.Team, goalsFor, goalsAgainst int) {
+	team.Played--
+	team.GoalsFor -= goalsFor
+	team.GoalsAgainst -= goalsAgainst
+	if goalsFor > goalsAgainst {
+		team.Won--
+	} else if goalsFor < goalsAgainst {
+		team.Lost--
+	} else {
+		team.Drawn--
+	}
+	team.UpdateStats()
+}
 
-	// Save changes
-	if err := h.MatchRepo.Update(match); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+// parseMatchFilter reads a match filter from the query string
+func parseMatchFilter(c *fiber.Ctx) (*models.MatchFilter, []*models.FieldError) {
+	var errs []*models.FieldError
+	queryInt := func(name string) int {
+		value := c.Query(name)
+		if value == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, &models.FieldError{Location: "query." + name, Message: "must be an integer"})
+		}
+		return n
+	}
+	queryTime := func(name string, endOfDay bool) time.Time {
+		value := c.Query(name)
+		if value == "" {
+			return time.Time{}
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t
+		}
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			errs = append(errs, &models.FieldError{Location: "query." + name, Message: "must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"})
+			return time.Time{}
+		}
+		// A date-only upper bound includes the whole day
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t
 	}
 
-	if err := h.TeamRepo.Update(homeTeam); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	filter := &models.MatchFilter{
+		TeamID:     queryInt("team"),
+		OpponentID: queryInt("opponent"),
+		Venue:      c.Query("venue"),
+		EditedOnly: c.QueryBool("edited", false),
+		WeekFrom:   queryInt("week_from"),
+		WeekTo:     queryInt("week_to"),
+		PlayedFrom: queryTime("from", false),
+		PlayedTo:   queryTime("to", true),
+		Page:       queryInt("page"),
+		PageSize:   queryInt("page_size"),
+	}
+	if played := c.Query("played"); played != "" {
+		value, err := strconv.ParseBool(played)
+		if err != nil {
+			errs = append(errs, &models.FieldError{Location: "query.played", Message: "must be true or false"})
+		}
+		filter.Played = &value
 	}
+	filter.Sort = strings.TrimPrefix(c.Query("sort"), "-")
+	filter.Descending = strings.HasPrefix(c.Query("sort"), "-")
 
-	if err := h.TeamRepo.Update(awayTeam); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	return filter, append(errs, filter.Validate()...)
+}
+
+// setPageHeaders sets X-Total-Count and a Link header to the next and previous pages
+func setPageHeaders(c *fiber.Ctx, page, pageSize, total int) {
+	c.Set("X-Total-Count", strconv.Itoa(total))
+
+	query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return
+	}
+	pageLink := func(page int, rel string) string {
+		query.Set("page", strconv.Itoa(page))
+		return fmt.Sprintf("<%s?%s>; rel=\"%s\"", c.Path(), query.Encode(), rel)
 	}
 
-	return c.JSON(match)
-} 
\ No newline at end of file
+	var links []string
+	if page*pageSize < total {
+		links = append(links, pageLink(page+1, "next"))
+	}
+	if page > 1 {
+		links = append(links, pageLink(page-1, "prev"))
+	}
+	if len(links) > 0 {
+		c.Set(fiber.HeaderLink, strings.Join(links, ", "))
+	}
+}
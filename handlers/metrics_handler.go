@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/metrics"
+)
+
+// MetricsHandler serves the application's metrics to Prometheus
+type MetricsHandler struct {
+	Registry *metrics.Registry
+	// Token is the bearer token scrapers must send; the metrics name every tenant, so they are never public
+	Token string
+}
+
+// NewMetricsHandler creates a new MetricsHandler that only answers requests bearing token
+func NewMetricsHandler(registry *metrics.Registry, token string) *MetricsHandler {
+	return &MetricsHandler{
+		Registry: registry,
+		Token:    token,
+	}
+}
+
+// GetMetrics writes every metric in the Prometheus text format
+func (h *MetricsHandler) GetMetrics(c *fiber.Ctx) error {
+	token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if h.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) != 1 {
+		c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+		return problem(c, http.StatusUnauthorized, "A valid metrics token is required")
+	}
+
+	var body bytes.Buffer
+	if err := h.Registry.Write(c.Context(), &body); err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.Send(body.Bytes())
+}
+
+// RequestMetrics records how long each request took by method, route pattern and status code.
+// The route pattern, such as /api/teams/:id, keeps the number of series small.
+func RequestMetrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		started := time.Now()
+		err := c.Next()
+
+		// Errors returned to Fiber are turned into responses after the middleware has run
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = http.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+
+		metrics.HTTPRequestDuration.Observe(time.Since(started).Seconds(), c.Method(), c.Route().Path, strconv.Itoa(status))
+		return err
+	}
+}
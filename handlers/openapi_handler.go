@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/openapi"
+)
+
+// OpenAPIHandler serves the API's OpenAPI document and checks requests against it
+type OpenAPIHandler struct {
+	Spec *openapi.Spec
+}
+
+// NewOpenAPIHandler creates a new OpenAPIHandler
+func NewOpenAPIHandler(spec *openapi.Spec) *OpenAPIHandler {
+	return &OpenAPIHandler{
+		Spec: spec,
+	}
+}
+
+// GetDocument returns the OpenAPI 3 document
+func (h *OpenAPIHandler) GetDocument(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Send(openapi.Document())
+}
+
+// GetDocs returns the interactive documentation page
+func (h *OpenAPIHandler) GetDocs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(openapi.DocsPage())
+}
+
+// ValidateRequest rejects requests whose parameters or JSON body do not match the OpenAPI document,
+// listing every problem, and bodies in a format the operation does not accept with 415
+func (h *OpenAPIHandler) ValidateRequest() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+		if err != nil {
+			return problem(c, http.StatusBadRequest, "Invalid query string")
+		}
+
+		errs, err := h.Spec.Validate(&openapi.Request{
+			Method:      c.Method(),
+			Path:        c.Path(),
+			Query:       query,
+			ContentType: c.Get(fiber.HeaderContentType),
+			Body:        c.Body(),
+		})
+		if errors.Is(err, openapi.ErrUnsupportedMediaType) {
+			return problem(c, http.StatusUnsupportedMediaType, err.Error())
+		}
+		if len(errs) > 0 {
+			return validationProblem(c, errs)
+		}
+
+		return c.Next()
+	}
+}
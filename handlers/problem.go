@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+)
+
+// problem responds with RFC 7807 problem details for the status code
+func problem(c *fiber.Ctx, status int, detail string) error {
+	return sendProblem(c, &models.Problem{
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// validationProblem responds with a 400 listing every invalid part of the request
+func validationProblem(c *fiber.Ctx, errs []*models.FieldError) error {
+	return sendProblem(c, &models.Problem{
+		Status: http.StatusBadRequest,
+		Detail: "The request is invalid",
+		Errors: errs,
+	})
+}
+
+// sendProblem fills in the common problem fields and writes the response
+func sendProblem(c *fiber.Ctx, p *models.Problem) error {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = c.Path()
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	c.Status(p.Status)
+	c.Set(fiber.HeaderContentType, models.ProblemContentType)
+	return c.Send(body)
+}
+
+// ErrorHandler answers errors returned to Fiber, such as unknown routes, with problem details
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	}
+	return problem(c, status, err.Error())
+}
@@ -2,34 +2,104 @@ package handlers
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
 )
 
-// SetupRoutes sets up all the routes for the application
-func SetupRoutes(app *fiber.App, teamHandler *TeamHandler, matchHandler *MatchHandler, leagueHandler *LeagueHandler) {
-	// API group
-	api := app.Group("/api")
+// SetupRoutes sets up all the routes for the application.
+// Every API route runs in the workspace of the request's tenant and is described in openapi/openapi.json.
+// Read-only routes are public, including the POST routes that only compute a result, such as unsaved
+// scenarios and experiments and the prediction and experiment jobs that run them in the background;
+// routes that change data require an API key with a suitable role.
+func SetupRoutes(app *fiber.App, workspaces *WorkspaceRegistry, authHandler *AuthHandler, tenantHandler *TenantHandler, openAPIHandler *OpenAPIHandler, idempotencyHandler *IdempotencyHandler) {
+	viewer := authHandler.RequireRole(models.RoleViewer)
+	editor := authHandler.RequireRole(models.RoleEditor)
+	admin := authHandler.RequireRole(models.RoleAdmin)
+	platformAdmin := authHandler.RequirePlatformAdmin()
+
+	// API documentation, outside the tenant workspaces
+	app.Get("/api/openapi.json", openAPIHandler.GetDocument)
+	app.Get("/api/docs", openAPIHandler.GetDocs)
+
+	// API group; requests only reach the tenants their API key belongs to, and POST and PUT requests
+	// with an Idempotency-Key are only run once
+	api := app.Group("/api", workspaces.Middleware(), authHandler.RequireTenantAccess(), idempotencyHandler.Middleware())
+
+	// Every API route checks its request against the OpenAPI document right before the handler, after the
+	// route's role check, so that callers without access learn nothing about what a valid request looks like
+	validate := openAPIHandler.ValidateRequest()
 
 	// Teams routes
 	teams := api.Group("/teams")
-	teams.Get("/", teamHandler.GetAllTeams)
-	teams.Get("/:id", teamHandler.GetTeamByID)
-	teams.Post("/", teamHandler.CreateTeam)
-	teams.Put("/:id", teamHandler.UpdateTeam)
-	teams.Delete("/:id", teamHandler.DeleteTeam)
+	teams.Get("/", validate, teamRoute((*TeamHandler).GetAllTeams))
+	teams.Get("/:id", validate, teamRoute((*TeamHandler).GetTeamByID))
+	teams.Get("/:id/matches", validate, teamRoute((*TeamHandler).GetTeamMatches))
+	teams.Get("/:id/head-to-head/:otherId", validate, teamRoute((*TeamHandler).GetHeadToHead))
+	teams.Post("/", editor, validate, teamRoute((*TeamHandler).CreateTeam))
+	teams.Post("/calibrate", editor, validate, calibrationRoute((*CalibrationHandler).CalibrateRatings))
+	teams.Put("/:id", editor, validate, teamRoute((*TeamHandler).UpdateTeam))
+	teams.Delete("/:id", admin, validate, teamRoute((*TeamHandler).DeleteTeam))
 
 	// Matches routes
 	matches := api.Group("/matches")
-	matches.Get("/", matchHandler.GetAllMatches)
-	matches.Get("/week/:week", matchHandler.GetMatchesByWeek)
-	matches.Post("/week/:week/simulate", matchHandler.SimulateWeek)
-	matches.Post("/simulate-all", matchHandler.SimulateAllRemainingMatches)
-	matches.Put("/:id", matchHandler.UpdateMatchResult)
+	matches.Get("/", validate, matchRoute((*MatchHandler).GetAllMatches))
+	matches.Get("/week/:week", validate, matchRoute((*MatchHandler).GetMatchesByWeek))
+	matches.Get("/:id", validate, matchRoute((*MatchHandler).GetMatchByID))
+	matches.Get("/:id/odds", validate, matchRoute((*MatchHandler).GetMatchOdds))
+	matches.Post("/week/:week/simulate", editor, validate, matchRoute((*MatchHandler).SimulateWeek))
+	matches.Post("/simulate-all", editor, validate, matchRoute((*MatchHandler).SimulateAllRemainingMatches))
+	matches.Put("/:id", editor, validate, matchRoute((*MatchHandler).UpdateMatchResult))
 
 	// League routes
 	league := api.Group("/league")
-	league.Get("/", leagueHandler.GetCurrentLeague)
-	league.Get("/table", leagueHandler.GetLeagueTable)
-	league.Get("/prediction", leagueHandler.GetPrediction)
-	league.Post("/", leagueHandler.CreateLeague)
-	league.Post("/reset", leagueHandler.ResetLeague)
-} 
\ No newline at end of file
+	league.Get("/", validate, leagueRoute((*LeagueHandler).GetCurrentLeague))
+	league.Get("/table", validate, leagueRoute((*LeagueHandler).GetLeagueTable))
+	league.Get("/prediction", validate, leagueRoute((*LeagueHandler).GetPrediction))
+	league.Get("/outlook", validate, leagueRoute((*LeagueHandler).GetOutlook))
+	league.Post("/", admin, validate, leagueRoute((*LeagueHandler).CreateLeague))
+	league.Post("/reset", admin, validate, leagueRoute((*LeagueHandler).ResetLeague))
+	league.Put("/prediction-rule", admin, validate, leagueRoute((*LeagueHandler).UpdatePredictionRule))
+
+	// Scenario routes
+	scenarios := api.Group("/scenarios")
+	scenarios.Get("/", validate, scenarioRoute((*ScenarioHandler).GetAllScenarios))
+	scenarios.Get("/:id", validate, scenarioRoute((*ScenarioHandler).GetScenario))
+	scenarios.Post("/", editor, validate, scenarioRoute((*ScenarioHandler).CreateScenario))
+	scenarios.Post("/run", validate, scenarioRoute((*ScenarioHandler).RunScenario))
+	scenarios.Delete("/:id", editor, validate, scenarioRoute((*ScenarioHandler).DeleteScenario))
+
+	// Experiment routes
+	api.Post("/experiments", validate, experimentRoute((*ExperimentHandler).RunExperiment))
+
+	// Job routes; jobs run in the background and are polled for their outcome
+	jobs := api.Group("/jobs")
+	jobs.Get("/", validate, jobRoute((*JobHandler).GetAllJobs))
+	jobs.Get("/:id", validate, jobRoute((*JobHandler).GetJob))
+	jobs.Post("/", validate, jobRoute((*JobHandler).CreateJob))
+	jobs.Post("/:id/cancel", validate, jobRoute((*JobHandler).CancelJob))
+
+	// Import routes
+	imports := api.Group("/import")
+	imports.Post("/teams", editor, validate, importRoute((*ImportHandler).ImportTeams))
+	imports.Post("/fixtures", editor, validate, importRoute((*ImportHandler).ImportFixtures))
+	imports.Post("/snapshot", admin, validate, importRoute((*ImportHandler).ImportSnapshot))
+
+	// Export routes
+	exports := api.Group("/export")
+	exports.Get("/table", validate, exportRoute((*ExportHandler).ExportTable))
+	exports.Get("/matches", validate, exportRoute((*ExportHandler).ExportMatches))
+	exports.Get("/prediction", validate, exportRoute((*ExportHandler).ExportPrediction))
+	exports.Get("/snapshot", validate, exportRoute((*ExportHandler).ExportSnapshot))
+
+	// API key routes
+	keys := api.Group("/keys")
+	keys.Get("/me", viewer, validate, authHandler.GetCurrentKey)
+	keys.Get("/", admin, validate, authHandler.GetAllKeys)
+	keys.Post("/", admin, validate, authHandler.CreateKey)
+	keys.Delete("/:id", admin, validate, authHandler.DeleteKey)
+
+	// Tenant routes
+	tenants := api.Group("/tenants")
+	tenants.Get("/current", validate, tenantHandler.GetCurrentTenant)
+	tenants.Get("/", admin, platformAdmin, validate, tenantHandler.GetAllTenants)
+	tenants.Post("/", admin, platformAdmin, validate, tenantHandler.CreateTenant)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// ScenarioHandler handles what-if scenario requests
+type ScenarioHandler struct {
+	ScenarioRepo services.ScenarioRepository
+	Scenarios    *services.ScenarioService
+}
+
+// NewScenarioHandler creates a new ScenarioHandler
+func NewScenarioHandler(scenarioRepo services.ScenarioRepository, scenarios *services.ScenarioService) *ScenarioHandler {
+	return &ScenarioHandler{
+		ScenarioRepo: scenarioRepo,
+		Scenarios:    scenarios,
+	}
+}
+
+// GetAllScenarios returns all saved scenarios
+func (h *ScenarioHandler) GetAllScenarios(c *fiber.Ctx) error {
+	scenarios, err := h.ScenarioRepo.GetAll(c.UserContext())
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(scenarios)
+}
+
+// GetScenario runs a saved scenario against the current league state
+func (h *ScenarioHandler) GetScenario(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid scenario ID")
+	}
+
+	ctx, cancel, err := simulationContext(c)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+	defer cancel()
+
+	result, err := h.Scenarios.RunSaved(ctx, id)
+	if err != nil {
+		return scenarioError(c, err)
+	}
+
+	return c.JSON(result)
+}
+
+// RunScenario simulates a scenario without saving it
+func (h *ScenarioHandler) RunScenario(c *fiber.Ctx) error {
+	scenario := new(models.Scenario)
+	if err := c.BodyParser(scenario); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+
+	ctx, cancel, err := simulationContext(c)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+	defer cancel()
+
+	result, err := h.Scenarios.Run(ctx, scenario)
+	if err != nil {
+		return scenarioError(c, err)
+	}
+
+	return c.JSON(result)
+}
+
+// CreateScenario saves a scenario so it can be shared by ID and returns its first run
+func (h *ScenarioHandler) CreateScenario(c *fiber.Ctx) error {
+	scenario := new(models.Scenario)
+	if err := c.BodyParser(scenario); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+
+	if scenario.Name == "" {
+		return problem(c, http.StatusBadRequest, "Scenario name is required")
+	}
+
+	ctx, cancel, err := simulationContext(c)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+	defer cancel()
+
+	result, err := h.Scenarios.Save(ctx, scenario)
+	if err != nil {
+		return scenarioError(c, err)
+	}
+
+	return c.Status(http.StatusCreated).JSON(result)
+}
+
+// DeleteScenario deletes a saved scenario
+func (h *ScenarioHandler) DeleteScenario(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid scenario ID")
+	}
+
+	if err := h.ScenarioRepo.Delete(c.UserContext(), id); err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// scenarioError maps scenario service errors to responses
+func scenarioError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrInvalidScenario) {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, services.ErrScenarioNotFound) {
+		return problem(c, http.StatusNotFound, "Scenario not found")
+	}
+	if isSimulationCancelled(err) {
+		return simulationCancelledResponse(c)
+	}
+	return problem(c, http.StatusInternalServerError, err.Error())
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -12,22 +13,22 @@ import (
 // TeamHandler handles team related requests
 type TeamHandler struct {
 	TeamRepo services.TeamRepository
+	Service  *services.TeamService
 }
 
 // NewTeamHandler creates a new TeamHandler
-func NewTeamHandler(teamRepo services.TeamRepository) *TeamHandler {
+func NewTeamHandler(teamRepo services.TeamRepository, service *services.TeamService) *TeamHandler {
 	return &TeamHandler{
 		TeamRepo: teamRepo,
+		Service:  service,
 	}
 }
 
 // GetAllTeams returns all teams
 func (h *TeamHandler) GetAllTeams(c *fiber.Ctx) error {
-	teams, err := h.TeamRepo.GetAll()
+	teams, err := h.TeamRepo.GetAll(c.UserContext())
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
 	return c.JSON(teams)
@@ -37,78 +38,135 @@ func (h *TeamHandler) GetAllTeams(c *fiber.Ctx) error {
 func (h *TeamHandler) GetTeamByID(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid team ID",
-		})
+		return problem(c, http.StatusBadRequest, "Invalid team ID")
 	}
 
-	team, err := h.TeamRepo.GetByID(id)
+	team, err := h.TeamRepo.GetByID(c.UserContext(), id)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{
-			"error": "Team not found",
-		})
+		return problem(c, http.StatusNotFound, "Team not found")
 	}
 
+	setETag(c, team.Version)
 	return c.JSON(team)
 }
 
-// CreateTeam creates a new team
+// CreateTeam creates a new team with empty standings
 func (h *TeamHandler) CreateTeam(c *fiber.Ctx) error {
-	team := new(models.Team)
-	if err := c.BodyParser(team); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	request := new(models.TeamRequest)
+	if err := c.BodyParser(request); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+	if errs := request.Validate(); len(errs) > 0 {
+		return validationProblem(c, errs)
 	}
 
-	if err := h.TeamRepo.Create(team); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	team, err := h.Service.Create(c.UserContext(), request)
+	if err != nil {
+		return teamError(c, err)
 	}
 
+	setETag(c, team.Version)
 	return c.Status(http.StatusCreated).JSON(team)
 }
 
-// UpdateTeam updates an existing team
+// UpdateTeam changes a team's name and ratings; its standings only change by playing matches.
+// With an If-Match header the team must still be at that version.
 func (h *TeamHandler) UpdateTeam(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid team ID",
-		})
+		return problem(c, http.StatusBadRequest, "Invalid team ID")
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
 	}
 
-	team := new(models.Team)
-	if err := c.BodyParser(team); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	request := new(models.TeamRequest)
+	if err := c.BodyParser(request); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+	if errs := request.Validate(); len(errs) > 0 {
+		return validationProblem(c, errs)
 	}
 
-	team.ID = id
-	if err := h.TeamRepo.Update(team); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	team, err := h.Service.Update(c.UserContext(), id, request, version)
+	if err != nil {
+		return teamError(c, err)
 	}
 
+	setETag(c, team.Version)
 	return c.JSON(team)
 }
 
+// GetTeamMatches returns a team's results, upcoming fixtures and a summary with its form over the last ?form=N results
+func (h *TeamHandler) GetTeamMatches(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid team ID")
+	}
+
+	formMatches := c.QueryInt("form", models.DefaultFormMatches)
+	if formMatches < 1 {
+		return problem(c, http.StatusBadRequest, "Invalid form value")
+	}
+
+	teamMatches, err := h.Service.Matches(c.UserContext(), id, formMatches)
+	if err != nil {
+		return teamError(c, err)
+	}
+
+	return c.JSON(teamMatches)
+}
+
+// GetHeadToHead returns the record of the meetings between two teams, their last ?recent=N results
+// and the outcome probabilities of their next meeting
+func (h *TeamHandler) GetHeadToHead(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid team ID")
+	}
+	otherID, err := strconv.Atoi(c.Params("otherId"))
+	if err != nil {
+		return problem(c, http.StatusBadRequest, "Invalid team ID")
+	}
+
+	recentMatches := c.QueryInt("recent", models.DefaultRecentMeetings)
+	if recentMatches < 0 {
+		return problem(c, http.StatusBadRequest, "Invalid recent value")
+	}
+
+	headToHead, err := h.Service.HeadToHead(c.UserContext(), id, otherID, recentMatches)
+	if err != nil {
+		return teamError(c, err)
+	}
+
+	return c.JSON(headToHead)
+}
+
+// teamError maps team service errors to problem responses
+func teamError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrTeamNotFound):
+		return problem(c, http.StatusNotFound, "Team not found")
+	case errors.Is(err, services.ErrDuplicateTeamName):
+		return problem(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrSameTeam):
+		return problem(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrVersionConflict):
+		return versionConflict(c)
+	}
+	return problem(c, http.StatusInternalServerError, err.Error())
+}
+
 // DeleteTeam deletes a team
 func (h *TeamHandler) DeleteTeam(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid team ID",
-		})
+		return problem(c, http.StatusBadRequest, "Invalid team ID")
 	}
 
-	if err := h.TeamRepo.Delete(id); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	if err := h.TeamRepo.Delete(c.UserContext(), id); err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
 	}
 
 	return c.SendStatus(http.StatusNoContent)
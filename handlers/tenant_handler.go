@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// tenantSlugPattern limits slugs to values that are safe in headers and subdomains
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,48}[a-z0-9])?$`)
+
+// TenantHandler handles tenant management requests
+type TenantHandler struct {
+	TenantRepo services.TenantRepository
+}
+
+// NewTenantHandler creates a new TenantHandler
+func NewTenantHandler(tenantRepo services.TenantRepository) *TenantHandler {
+	return &TenantHandler{
+		TenantRepo: tenantRepo,
+	}
+}
+
+// GetCurrentTenant returns the tenant resolved for the request
+func (h *TenantHandler) GetCurrentTenant(c *fiber.Ctx) error {
+	return c.JSON(currentWorkspace(c).Tenant)
+}
+
+// GetAllTenants returns all tenants
+func (h *TenantHandler) GetAllTenants(c *fiber.Ctx) error {
+	tenants, err := h.TenantRepo.GetAll(c.UserContext())
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(tenants)
+}
+
+// CreateTenant creates a new tenant with a fresh copy of the sample league
+func (h *TenantHandler) CreateTenant(c *fiber.Ctx) error {
+	tenant := new(models.Tenant)
+	if err := c.BodyParser(tenant); err != nil {
+		return problem(c, http.StatusBadRequest, err.Error())
+	}
+
+	tenant.Slug = strings.ToLower(strings.TrimSpace(tenant.Slug))
+	if !tenantSlugPattern.MatchString(tenant.Slug) {
+		return problem(c, http.StatusBadRequest, "Tenant slug must be 1-50 lowercase letters, digits or hyphens")
+	}
+	if tenant.Name == "" {
+		tenant.Name = tenant.Slug
+	}
+
+	if _, err := h.TenantRepo.GetBySlug(c.UserContext(), tenant.Slug); err == nil {
+		return problem(c, http.StatusConflict, "Tenant already exists")
+	}
+
+	if err := h.TenantRepo.Create(c.UserContext(), tenant); err != nil {
+		return problem(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.Status(http.StatusCreated).JSON(tenant)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/user/footballsim/models"
+	"github.com/user/footballsim/services"
+)
+
+// workspaceLocal is the fiber.Ctx locals key holding the tenant's workspace
+const workspaceLocal = "workspace"
+
+// tenantFromHeaderLocal is the fiber.Ctx locals key recording whether X-Tenant chose the tenant
+const tenantFromHeaderLocal = "tenant_from_header"
+
+// TenantHeader names the request header that selects a tenant
+const TenantHeader = "X-Tenant"
+
+// Workspace holds the handlers of a single tenant, all backed by repositories scoped to that tenant
+type Workspace struct {
+	Tenant      *models.Tenant
+	Teams       *TeamHandler
+	Matches     *MatchHandler
+	League      *LeagueHandler
+	Calibration *CalibrationHandler
+	Scenarios   *ScenarioHandler
+	Import      *ImportHandler
+	Export      *ExportHandler
+	Experiments *ExperimentHandler
+	Jobs        *JobHandler
+}
+
+// WorkspaceFactory builds the workspace of a tenant
+type WorkspaceFactory func(tenant *models.Tenant) *Workspace
+
+// WorkspaceRegistry resolves the tenant of each request and keeps one workspace per tenant
+type WorkspaceRegistry struct {
+	TenantRepo services.TenantRepository
+	Factory    WorkspaceFactory
+	// BaseDomain enables subdomain tenants: acme.<BaseDomain> selects the "acme" tenant
+	BaseDomain string
+
+	mu         sync.Mutex
+	workspaces map[string]*Workspace
+}
+
+// NewWorkspaceRegistry creates a new WorkspaceRegistry
+func NewWorkspaceRegistry(tenantRepo services.TenantRepository, factory WorkspaceFactory, baseDomain string) *WorkspaceRegistry {
+	return &WorkspaceRegistry{
+		TenantRepo: tenantRepo,
+		Factory:    factory,
+		BaseDomain: baseDomain,
+		workspaces: make(map[string]*Workspace),
+	}
+}
+
+// Middleware resolves the request's tenant from the X-Tenant header or the subdomain,
+// falling back to the default tenant, and makes its workspace available to the route
+func (r *WorkspaceRegistry) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		slug, fromHeader := r.tenantSlug(c)
+		workspace, err := r.workspace(c.UserContext(), slug)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return problem(c, http.StatusNotFound, "Unknown tenant")
+			}
+			return problem(c, http.StatusInternalServerError, err.Error())
+		}
+
+		c.Locals(workspaceLocal, workspace)
+		c.Locals(tenantFromHeaderLocal, fromHeader)
+		return c.Next()
+	}
+}
+
+// tenantSlug returns the slug of the tenant named by the request, and whether the X-Tenant header
+// chose a tenant other than the host name's
+func (r *WorkspaceRegistry) tenantSlug(c *fiber.Ctx) (string, bool) {
+	hostSlug := r.hostTenantSlug(c)
+	if slug := strings.TrimSpace(c.Get(TenantHeader)); slug != "" {
+		slug = strings.ToLower(slug)
+		return slug, slug != hostSlug
+	}
+	return hostSlug, false
+}
+
+// hostTenantSlug returns the slug of the tenant named by the request's subdomain, or the default tenant's
+func (r *WorkspaceRegistry) hostTenantSlug(c *fiber.Ctx) string {
+	if r.BaseDomain != "" {
+		host := strings.ToLower(c.Hostname())
+		if i := strings.IndexByte(host, ':'); i >= 0 {
+			host = host[:i]
+		}
+		if sub := strings.TrimSuffix(host, "."+r.BaseDomain); sub != host && sub != "" && !strings.Contains(sub, ".") {
+			return sub
+		}
+	}
+
+	return models.DefaultTenantSlug
+}
+
+// workspace returns the cached workspace of a tenant, building it on first use
+func (r *WorkspaceRegistry) workspace(ctx context.Context, slug string) (*Workspace, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if workspace, ok := r.workspaces[slug]; ok {
+		return workspace, nil
+	}
+
+	tenant, err := r.TenantRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	workspace := r.Factory(tenant)
+	r.workspaces[slug] = workspace
+	return workspace, nil
+}
+
+// TenantWorkspace returns the workspace of a tenant by ID, for work that runs outside a request such as jobs
+func (r *WorkspaceRegistry) TenantWorkspace(ctx context.Context, tenantID int) (*Workspace, error) {
+	r.mu.Lock()
+	for _, workspace := range r.workspaces {
+		if workspace.Tenant.ID == tenantID {
+			r.mu.Unlock()
+			return workspace, nil
+		}
+	}
+	r.mu.Unlock()
+
+	tenant, err := r.TenantRepo.GetByID(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return r.workspace(ctx, tenant.Slug)
+}
+
+// currentWorkspace returns the workspace resolved for the request
+func currentWorkspace(c *fiber.Ctx) *Workspace {
+	return c.Locals(workspaceLocal).(*Workspace)
+}
+
+// The route helpers below dispatch a handler method to the handler of the request's workspace
+
+func teamRoute(handler func(*TeamHandler, *fiber.Ctx) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return handler(currentWorkspace(c).Teams, c)
+	}
+}
+
+func matchRoute(handler func(*MatchHandler, *fiber.Ctx) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return handler(currentWorkspace(c).Matches, c)
+	}
+}
+
+func leagueRoute(handler func(*LeagueHandler, *fiber.Ctx) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return handler(currentWorkspace(c).League, c)
+	}
+}
+
+func calibrationRoute(handler func(*CalibrationHandler, *fiber.Ctx) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return handler(currentWorkspace(c).Calibration, c)
+	}
+}
+
+func scenarioRoute(handler func(*ScenarioHandler, *fiber.Ctx) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return handler(currentWorkspace(c).Scenarios, c)
+	}
+}
+
+func importRoute(handler func(*ImportHandler, *fiber.Ctx) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return handler(currentWorkspace(c).Import, c)
+	}
+}
+
+func exportRoute(handler func(*ExportHandler, *fiber.Ctx) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return handler(currentWorkspace(c).Export, c)
+	}
+}
+
+func experimentRoute(handler func(*ExperimentHandler, *fiber.Ctx) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return handler(currentWorkspace(c).Experiments, c)
+	}
+}
+
+func jobRoute(handler func(*JobHandler, *fiber.Ctx) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return handler(currentWorkspace(c).Jobs, c)
+	}
+}
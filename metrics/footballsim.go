@@ -0,0 +1,46 @@
+package metrics
+
+// The application's metrics, all registered in Default
+var (
+	HTTPRequestDuration = Default.NewHistogram(
+		"footballsim_http_request_duration_seconds",
+		"Time taken to answer HTTP requests, by method, route pattern and status code.",
+		DefaultBuckets, "method", "route", "status")
+
+	MatchesSimulated = Default.NewCounter(
+		"footballsim_matches_simulated_total",
+		"League matches played by the simulator and saved.")
+	ResultsEdited = Default.NewCounter(
+		"footballsim_results_edited_total",
+		"Match results entered or changed by hand.")
+	PredictionRuns = Default.NewCounter(
+		"footballsim_prediction_runs_total",
+		"Rest-of-season simulations run for predictions and scenarios.")
+
+	CurrentWeek = Default.NewGauge(
+		"footballsim_league_current_week",
+		"Current week of each tenant's league.",
+		"tenant")
+
+	DBOpenConnections = Default.NewGauge(
+		"footballsim_db_open_connections",
+		"Established database connections, in use or idle.")
+	DBInUseConnections = Default.NewGauge(
+		"footballsim_db_in_use_connections",
+		"Database connections currently in use.")
+	DBIdleConnections = Default.NewGauge(
+		"footballsim_db_idle_connections",
+		"Idle database connections.")
+	DBMaxOpenConnections = Default.NewGauge(
+		"footballsim_db_max_open_connections",
+		"Maximum number of open database connections, 0 for unlimited.")
+	DBWaitCount = Default.NewCounter(
+		"footballsim_db_wait_count_total",
+		"Times a query waited for a free database connection.")
+	DBWaitDuration = Default.NewCounter(
+		"footballsim_db_wait_duration_seconds_total",
+		"Total time queries waited for a free database connection.")
+	DBErrors = Default.NewCounter(
+		"footballsim_db_errors_total",
+		"Database queries and transactions that failed, other than by cancellation.")
+)
@@ -0,0 +1,309 @@
+// Package metrics keeps counters, gauges and histograms in memory and writes them
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram upper bounds in seconds, up to the default request timeout
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metric is a named family of series that can write itself in the text format
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics exposed by /metrics
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	hooks   []func(ctx context.Context)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry the application's metrics are registered in
+var Default = NewRegistry()
+
+// OnScrape adds a function that updates gauges right before the metrics are written
+func (r *Registry) OnScrape(hook func(ctx context.Context)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+// Write runs the scrape hooks and writes every metric in the Prometheus text format
+func (r *Registry) Write(ctx context.Context, w io.Writer) error {
+	r.mu.Lock()
+	hooks := append([]func(ctx context.Context){}, r.hooks...)
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(ctx)
+	}
+
+	writer := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(writer)
+	}
+	return writer.Flush()
+}
+
+// register adds a metric to the registry
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// family holds what all series of a metric share
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+}
+
+// header writes the HELP and TYPE lines of the family
+func (f *family) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+// key joins label values into a map key. A metric is not worth failing a request for,
+// so when the number of values does not match the labels it logs the mistake and returns false.
+func (f *family) key(labelValues []string) (string, bool) {
+	if len(labelValues) != len(f.labelNames) {
+		log.Printf("metrics: %s takes %d label values, got %d; observation dropped", f.name, len(f.labelNames), len(labelValues))
+		return "", false
+	}
+	return strings.Join(labelValues, "\xff"), true
+}
+
+// labels formats the labels of a series, with an optional extra label such as le
+func (f *family) labels(key string, extra ...string) string {
+	pairs := make([]string, 0, len(f.labelNames)+1)
+	if len(f.labelNames) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, f.labelNames[i]+`="`+escapeLabel(value)+`"`)
+		}
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escapeLabel(extra[1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabel escapes a label value for the text format
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// escapeHelp escapes a HELP text for the text format, which unlike a label value keeps its quotes
+func escapeHelp(help string) string {
+	help = strings.ReplaceAll(help, `\`, `\\`)
+	return strings.ReplaceAll(help, "\n", `\n`)
+}
+
+// formatValue formats a sample value for the text format
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of a series map in a stable order
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// values is a set of float series shared by counters and gauges
+type values struct {
+	family
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+// write writes the family and its series
+func (v *values) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.header(w)
+	for _, key := range sortedKeys(v.series) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labels(key), formatValue(v.series[key]))
+	}
+}
+
+// Counter is a value that only goes up, such as the number of matches simulated
+type Counter struct {
+	values
+}
+
+// NewCounter creates a counter and registers it in the registry
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{values{family: family{name, help, "counter", labelNames}, series: make(map[string]float64)}}
+	if len(labelNames) == 0 {
+		// Unlabelled counters are exposed from zero rather than from their first increment
+		c.series[""] = 0
+	}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta to the counter. Counters cannot decrease, so a negative delta is logged and dropped.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		log.Printf("metrics: counter %s cannot decrease by %v; observation dropped", c.name, delta)
+		return
+	}
+	key, ok := c.key(labelValues)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	c.series[key] += delta
+	c.mu.Unlock()
+}
+
+// Set sets the counter to a total kept elsewhere, such as the wait count of a connection pool
+func (c *Counter) Set(value float64, labelValues ...string) {
+	key, ok := c.key(labelValues)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	c.series[key] = value
+	c.mu.Unlock()
+}
+
+// Gauge is a value that can go up and down, such as the current week
+type Gauge struct {
+	values
+}
+
+// NewGauge creates a gauge and registers it in the registry
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{values{family: family{name, help, "gauge", labelNames}, series: make(map[string]float64)}}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	key, ok := g.key(labelValues)
+	if !ok {
+		return
+	}
+	g.mu.Lock()
+	g.series[key] = value
+	g.mu.Unlock()
+}
+
+// Reset removes every series, so that a scrape hook can drop label values that no longer exist
+func (g *Gauge) Reset() {
+	g.mu.Lock()
+	g.series = make(map[string]float64)
+	g.mu.Unlock()
+}
+
+// histogramSeries holds the observations of one histogram series
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Histogram counts observations, such as request durations, in buckets
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds and registers it in the registry
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{
+		family:  family{name, help, "histogram", labelNames},
+		buckets: append([]float64{}, buckets...),
+		series:  make(map[string]*histogramSeries),
+	}
+	sort.Float64s(h.buckets)
+	r.register(h)
+	return h
+}
+
+// Observe records one observation
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key, ok := h.key(labelValues)
+	if !ok {
+		return
+	}
+	bucket := sort.SearchFloat64s(h.buckets, value)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	if bucket < len(h.buckets) {
+		series.counts[bucket]++
+	}
+	series.count++
+	series.sum += value
+}
+
+// write writes the histogram's buckets, sums and counts
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(key), formatValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(key), series.count)
+	}
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"plain", "GET", "GET"},
+		{"empty", "", ""},
+		{"quote", `say "hi"`, `say \"hi\"`},
+		{"backslash", `C:\teams`, `C:\\teams`},
+		{"newline", "two\nlines", `two\nlines`},
+		{"escaped quote", `\"`, `\\\"`},
+		{"all together", "a\\b\"c\nd", `a\\b\"c\nd`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeLabel(tt.value); got != tt.want {
+				t.Errorf("escapeLabel(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeHelp(t *testing.T) {
+	tests := []struct {
+		name string
+		help string
+		want string
+	}{
+		{"plain", "Requests served", "Requests served"},
+		{"quotes are kept", `The "top" places`, `The "top" places`},
+		{"backslash", `a\b`, `a\\b`},
+		{"newline", "first\nsecond", `first\nsecond`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeHelp(tt.help); got != tt.want {
+				t.Errorf("escapeHelp(%q) = %q, want %q", tt.help, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "0"},
+		{1.5, "1.5"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		if got := formatValue(tt.value); got != tt.want {
+			t.Errorf("formatValue(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(r *Registry)
+		want   []string
+	}{
+		{
+			name: "counter with escaped labels",
+			record: func(r *Registry) {
+				counter := r.NewCounter("requests_total", "Requests\nserved", "route", "status")
+				counter.Inc(`/api/teams/"x"`, "200")
+				counter.Add(2, `C:\path`, "line\nbreak")
+			},
+			want: []string{
+				`# HELP requests_total Requests\nserved`,
+				`# TYPE requests_total counter`,
+				`requests_total{route="/api/teams/\"x\"",status="200"} 1`,
+				`requests_total{route="C:\\path",status="line\nbreak"} 2`,
+			},
+		},
+		{
+			name: "gauge without labels",
+			record: func(r *Registry) {
+				r.NewGauge("teams", `Teams in the \ league`).Set(4)
+			},
+			want: []string{
+				`# HELP teams Teams in the \\ league`,
+				`# TYPE teams gauge`,
+				`teams 4`,
+			},
+		},
+		{
+			name: "histogram buckets with escaped labels",
+			record: func(r *Registry) {
+				r.NewHistogram("duration_seconds", "Request duration", []float64{0.1, 1}, "route").Observe(0.5, `a"b`)
+			},
+			want: []string{
+				`# TYPE duration_seconds histogram`,
+				`duration_seconds_bucket{route="a\"b",le="0.1"} 0`,
+				`duration_seconds_bucket{route="a\"b",le="1"} 1`,
+				`duration_seconds_bucket{route="a\"b",le="+Inf"} 1`,
+				`duration_seconds_sum{route="a\"b"} 0.5`,
+				`duration_seconds_count{route="a\"b"} 1`,
+			},
+		},
+		{
+			name: "mismatched label values are dropped",
+			record: func(r *Registry) {
+				counter := r.NewCounter("errors_total", "Errors", "kind")
+				counter.Inc()
+				counter.Inc("a", "b")
+				counter.Add(-1, "a")
+			},
+			want: []string{
+				`# TYPE errors_total counter`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			tt.record(registry)
+
+			var out bytes.Buffer
+			if err := registry.Write(context.Background(), &out); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			for _, want := range tt.want {
+				if !containsLine(lines, want) {
+					t.Errorf("output has no line %s\n%s", want, out.String())
+				}
+			}
+			for _, line := range lines {
+				if !strings.HasPrefix(line, "#") && !containsLine(tt.want, line) {
+					t.Errorf("unexpected sample %s", line)
+				}
+			}
+		})
+	}
+}
+
+// containsLine returns true if lines holds line
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// API key roles, from least to most privileged
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// roleLevels orders the roles so that higher roles include the rights of lower ones
+var roleLevels = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// APIKey represents a key that grants a role on the API. Only a hash of the key is stored.
+type APIKey struct {
+	ID        int       `json:"id" db:"id"`
+	TenantID  int       `json:"tenant_id" db:"tenant_id"` // 0 for the bootstrap key, which works in every tenant
+	Name      string    `json:"name" db:"name"`
+	Role      string    `json:"role" db:"role"`
+	Prefix    string    `json:"prefix" db:"prefix"` // First characters of the key, to tell keys apart
+	KeyHash   string    `json:"-" db:"key_hash"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// IsValidRole returns true if the role is one of the known roles
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// CanAccessTenant returns true if the key may be used within the given tenant
+func (k *APIKey) CanAccessTenant(tenantID int) bool {
+	return k.TenantID == 0 || k.TenantID == tenantID
+}
+
+// HasRole returns true if the key's role includes the rights of the required role
+func (k *APIKey) HasRole(required string) bool {
+	return roleLevels[k.Role] >= roleLevels[required]
+}
@@ -0,0 +1,29 @@
+package models
+
+// TeamRating represents the fitted ratings of a single team
+type TeamRating struct {
+	TeamID           int     `json:"team_id"`
+	TeamName         string  `json:"team_name"`
+	Matches          int     `json:"matches"`
+	Attack           float64 `json:"attack"`
+	Defence          float64 `json:"defence"`
+	Strength         int     `json:"strength"`
+	PreviousStrength int     `json:"previous_strength"`
+}
+
+// CalibrationReport summarises a rating calibration run and the quality of the fit
+type CalibrationReport struct {
+	Source        string        `json:"source"`
+	MatchesUsed   int           `json:"matches_used"`
+	Ratings       []*TeamRating `json:"ratings"`
+	HomeAdvantage float64       `json:"home_advantage"` // Multiplier applied to the home team's scoring rate
+	AverageGoals  float64       `json:"average_goals"`  // Away goals expected between two average teams
+	Rho           float64       `json:"rho"`            // Dixon-Coles low score dependence parameter
+	LogLikelihood float64       `json:"log_likelihood"`
+	AIC           float64       `json:"aic"`
+	BrierScore    float64       `json:"brier_score"` // Mean 1X2 Brier score, lower is better
+	Accuracy      float64       `json:"accuracy"`    // Share of matches whose most likely outcome happened
+	Iterations    int           `json:"iterations"`
+	Converged     bool          `json:"converged"`
+	Applied       bool          `json:"applied"`
+}
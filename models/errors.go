@@ -0,0 +1,13 @@
+package models
+
+import "errors"
+
+// Errors shared by the repositories, services and handlers
+var (
+	// ErrVersionConflict is returned when a team, match or league was updated by someone else since it was read
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrLeagueBusy is returned when another simulation, reset or result edit holds the league lock
+	ErrLeagueBusy = errors.New("league is busy")
+	// ErrDuplicateTeamName is returned when a tenant already has a team of the same name, ignoring case
+	ErrDuplicateTeamName = errors.New("duplicate team name")
+)
@@ -0,0 +1,28 @@
+package models
+
+// ExperimentConfig describes a batch of complete seasons simulated from week 1
+type ExperimentConfig struct {
+	Seasons int `json:"seasons"`
+	Workers int `json:"workers"`
+	// HomeAdvantage overrides the simulator's home advantage when set
+	HomeAdvantage *float64 `json:"home_advantage,omitempty"`
+}
+
+// ExperimentReport aggregates the simulated seasons of an experiment
+type ExperimentReport struct {
+	Seasons       int     `json:"seasons"`
+	Workers       int     `json:"workers"`
+	HomeAdvantage float64 `json:"home_advantage"`
+	// StrongestTeamTitleRate is the share of seasons won by a team of the highest strength
+	StrongestTeamTitleRate float64 `json:"strongest_team_title_rate"`
+	// AverageTitleMargin is the mean points gap between first and second place
+	AverageTitleMargin float64 `json:"average_title_margin"`
+	// AveragePointsSpread is the mean standard deviation of the final points totals
+	AveragePointsSpread  float64             `json:"average_points_spread"`
+	HomeWinRate          float64             `json:"home_win_rate"`
+	DrawRate             float64             `json:"draw_rate"`
+	AwayWinRate          float64             `json:"away_win_rate"`
+	AverageGoalsPerMatch float64             `json:"average_goals_per_match"`
+	Teams                []*TeamDistribution `json:"teams"`
+	DurationMillis       int64               `json:"duration_ms"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// SnapshotVersion is the version of the league snapshot format written by this build
+const SnapshotVersion = 1
+
+// LeagueSnapshot is a complete, portable copy of a league. Matches refer to teams by name
+// so that a snapshot can be restored into another deployment, where the IDs differ.
+type LeagueSnapshot struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	League     *League          `json:"league"`
+	Teams      []*Team          `json:"teams"`
+	Matches    []*SnapshotMatch `json:"matches"`
+}
+
+// SnapshotMatch is a match in a league snapshot
+type SnapshotMatch struct {
+	Week          int        `json:"week"`
+	HomeTeam      string     `json:"home_team"`
+	AwayTeam      string     `json:"away_team"`
+	HomeTeamGoals int        `json:"home_team_goals"`
+	AwayTeamGoals int        `json:"away_team_goals"`
+	Played        bool       `json:"played"`
+	PlayedAt      *time.Time `json:"played_at,omitempty"`
+	IsEdited      bool       `json:"is_edited"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyKeyHeader is the request header that makes a POST or PUT safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key accepted
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyRecord represents a request made with an Idempotency-Key and, once it has completed, its response
+type IdempotencyRecord struct {
+	TenantID    int
+	Key         string
+	RequestHash string // Fingerprint of the method, path, body and credentials of the original request
+	Completed   bool
+	Status      int
+	ContentType string
+	ETag        string
+	Body        []byte
+	CreatedAt   time.Time
+}
@@ -0,0 +1,44 @@
+package models
+
+// Import kinds and formats
+const (
+	ImportKindTeams    = "teams"
+	ImportKindFixtures = "fixtures"
+	ImportKindSnapshot = "snapshot"
+
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	// FormatExcel is CSV with a byte order mark and CRLF line endings, which Excel opens directly
+	FormatExcel = "excel"
+)
+
+// TeamImportRow represents one team in an import file
+type TeamImportRow struct {
+	Name     string `json:"name"`
+	Strength int    `json:"strength"`
+}
+
+// FixtureImportRow represents one fixture in an import file. A fixture with a score is imported as played.
+type FixtureImportRow struct {
+	Week      int    `json:"week"`
+	HomeTeam  string `json:"home_team"`
+	AwayTeam  string `json:"away_team"`
+	HomeGoals *int   `json:"home_goals,omitempty"`
+	AwayGoals *int   `json:"away_goals,omitempty"`
+}
+
+// ImportError describes a problem with one line (CSV) or item (JSON, 1-based) of an import file
+type ImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ImportReport summarises an import. Nothing is written when there are errors or on a dry run.
+type ImportReport struct {
+	Kind     string         `json:"kind"`
+	Format   string         `json:"format"`
+	DryRun   bool           `json:"dry_run"`
+	Rows     int            `json:"rows"`
+	Imported int            `json:"imported"`
+	Errors   []*ImportError `json:"errors"`
+}
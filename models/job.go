@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job types
+const (
+	// JobSimulateRemaining plays every remaining match of the league, week by week
+	JobSimulateRemaining = "simulate_remaining"
+	// JobPrediction simulates the rest of the season many times and returns the final table distribution
+	JobPrediction = "prediction"
+	// JobExperiment simulates many complete seasons from week 1, as POST /api/experiments does
+	JobExperiment = "experiment"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobRequest asks for a job to be run in the background
+type JobRequest struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"` // Depends on the type; see PredictionJobParams and ExperimentConfig
+}
+
+// PredictionJobParams are the parameters of a prediction job
+type PredictionJobParams struct {
+	Runs int `json:"runs"`
+}
+
+// JobProgress counts the units of work a job has done, such as weeks, runs or seasons
+type JobProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"` // 0 until the job knows how much work there is
+}
+
+// Job represents a long operation run by the worker pool. Jobs are stored, so they survive a restart.
+type Job struct {
+	ID              int             `json:"id"`
+	TenantID        int             `json:"-"`
+	Type            string          `json:"type"`
+	Params          json.RawMessage `json:"params"`
+	Status          string          `json:"status"`
+	Progress        JobProgress     `json:"progress"`
+	Result          json.RawMessage `json:"result,omitempty"` // Set once the job has succeeded, or with a partial result when a prediction was cancelled
+	Error           string          `json:"error,omitempty"`
+	CancelRequested bool            `json:"cancel_requested"`
+	Attempts        int             `json:"attempts"` // Times a worker has started the job; more than 1 after a restart interrupted it
+	CreatedAt       time.Time       `json:"created_at"`
+	StartedAt       *time.Time      `json:"started_at"`
+	FinishedAt      *time.Time      `json:"finished_at"`
+}
+
+// IsFinished returns true once the job has stopped for good
+func (j *Job) IsFinished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// SimulatedMatches is the result of a simulate_remaining job
+type SimulatedMatches struct {
+	Matches []*Match `json:"matches"`
+}
@@ -1,5 +1,14 @@
 package models
 
+import "fmt"
+
+// Prediction availability rules
+const (
+	PredictionRuleMinWeeks         = "min_weeks"         // Available from week PredictionThreshold
+	PredictionRuleSeasonPercentage = "season_percentage" // Available once PredictionThreshold percent of the weeks are played
+	PredictionRuleAlways           = "always"
+)
+
 type League struct {
 	ID      int     `json:"id" db:"id"`
 	Name    string  `json:"name" db:"name"`
@@ -9,10 +18,77 @@ type League struct {
 	CurrentWeek int `json:"current_week" db:"current_week"`
 	TotalWeeks  int `json:"total_weeks" db:"total_weeks"`
 	IsCompleted bool `json:"is_completed" db:"is_completed"`
+	PredictionRule      string `json:"prediction_rule" db:"prediction_rule"`
+	PredictionThreshold int    `json:"prediction_threshold" db:"prediction_threshold"`
+	Version             int    `json:"version" db:"version"` // Raised by every update, for optimistic concurrency
+}
+
+// WeeksPlayed returns the number of weeks that have been completed
+func (l *League) WeeksPlayed() int {
+	if l.IsCompleted {
+		return l.TotalWeeks
+	}
+	return l.CurrentWeek - 1
+}
+
+// SeasonProgress returns the share of the season that has been played, between 0 and 1
+func (l *League) SeasonProgress() float64 {
+	if l.TotalWeeks <= 0 {
+		return 0
+	}
+	return float64(l.WeeksPlayed()) / float64(l.TotalWeeks)
+}
+
+// ValidatePredictionRule checks that the prediction rule and its threshold are usable
+func (l *League) ValidatePredictionRule() error {
+	switch l.PredictionRule {
+	case PredictionRuleMinWeeks:
+		if l.PredictionThreshold < 1 {
+			return fmt.Errorf("prediction_threshold must be at least 1 week")
+		}
+	case PredictionRuleSeasonPercentage:
+		if l.PredictionThreshold < 0 || l.PredictionThreshold > 100 {
+			return fmt.Errorf("prediction_threshold must be a percentage between 0 and 100")
+		}
+	case PredictionRuleAlways:
+	default:
+		return fmt.Errorf("unknown prediction_rule %q", l.PredictionRule)
+	}
+	return nil
 }
 
+// PredictionsAvailable reports whether the league's prediction rule allows a prediction yet
+func (l *League) PredictionsAvailable() bool {
+	switch l.PredictionRule {
+	case PredictionRuleAlways:
+		return true
+	case PredictionRuleSeasonPercentage:
+		return l.SeasonProgress()*100 >= float64(l.PredictionThreshold)
+	}
+	return l.CurrentWeek >= l.PredictionThreshold
+}
+
+// PredictionUnavailableReason describes when predictions become available under the league's rule
+func (l *League) PredictionUnavailableReason() string {
+	if l.PredictionRule == PredictionRuleSeasonPercentage {
+		return fmt.Sprintf("Predictions are only available after %d%% of the season has been played", l.PredictionThreshold)
+	}
+	return fmt.Sprintf("Predictions are only available from week %d", l.PredictionThreshold)
+}
+
+// League table views; every view other than the overall table is computed from played matches
+const (
+	TableViewOverall    = "overall"
+	TableViewHome       = "home"
+	TableViewAway       = "away"
+	TableViewForm       = "form"        // Each team's last N results
+	TableViewFirstHalf  = "first_half"  // Weeks up to half of the season
+	TableViewSecondHalf = "second_half" // Weeks after half of the season
+)
+
 // LeagueTable represents the current league standings
 type LeagueTable struct {
+	View         string       `json:"view"`
 	Teams        []*TeamStats `json:"teams"`
 	CurrentWeek  int          `json:"current_week"`
 	TotalWeeks   int          `json:"total_weeks"`
@@ -28,4 +104,27 @@ type WeeklyMatches struct {
 // PredictionTable represents the predicted final league standings
 type PredictionTable struct {
 	Teams []*TeamStats `json:"teams"`
-} 
\ No newline at end of file
+} 
+// TeamDistribution represents the spread of simulated final outcomes for one team
+type TeamDistribution struct {
+	TeamID                int       `json:"team_id"`
+	TeamName              string    `json:"team_name"`
+	AveragePoints         float64   `json:"average_points"`
+	AverageGoalDifference float64   `json:"average_goal_difference"`
+	ExpectedPosition      float64   `json:"expected_position"`
+	TitleProbability      float64   `json:"title_probability"`
+	PositionProbabilities []float64 `json:"position_probabilities"` // Index 0 is first place
+	PointsInterval        [2]int    `json:"points_interval"`          // Central 90% range of final points
+	PositionInterval      [2]int    `json:"position_interval"`        // Central 90% range of final positions
+}
+
+// TableDistribution represents the final table distribution over many simulated seasons.
+// A partial distribution stopped at a deadline before all requested runs were simulated.
+type TableDistribution struct {
+	Runs          int  `json:"runs"`
+	RequestedRuns int  `json:"requested_runs"`
+	Partial       bool `json:"partial"`
+	// ErrorBound is the largest 95% margin of error of the position probabilities
+	ErrorBound float64             `json:"error_bound"`
+	Teams      []*TeamDistribution `json:"teams"`
+}
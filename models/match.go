@@ -14,6 +14,7 @@ type Match struct {
 	Played        bool      `json:"played" db:"played"`
 	PlayedAt      time.Time `json:"played_at,omitempty" db:"played_at"`
 	IsEdited      bool      `json:"is_edited" db:"is_edited"`
+	Version       int       `json:"version" db:"version"` // Raised by every update, for optimistic concurrency
 }
 
 // MatchResult represents the result of a match
@@ -51,4 +52,35 @@ func (m *Match) IsAwayWin() bool {
 // IsDraw returns true if the match ended in a draw
 func (m *Match) IsDraw() bool {
 	return m.HomeTeamGoals == m.AwayTeamGoals
-} 
\ No newline at end of file
+} 
+// ScorelineProbability represents the probability of a single final score
+type ScorelineProbability struct {
+	HomeTeamGoals int     `json:"home_team_goals"`
+	AwayTeamGoals int     `json:"away_team_goals"`
+	Probability   float64 `json:"probability"`
+}
+
+// DecimalOdds represents fair decimal odds for the three match outcomes
+type DecimalOdds struct {
+	HomeWin float64 `json:"home_win"`
+	Draw    float64 `json:"draw"`
+	AwayWin float64 `json:"away_win"`
+}
+
+// MatchOdds represents the outcome probabilities of a fixture
+type MatchOdds struct {
+	MatchID           int                     `json:"match_id,omitempty"`
+	Week              int                     `json:"week,omitempty"`
+	HomeTeamID        int                     `json:"home_team_id"`
+	AwayTeamID        int                     `json:"away_team_id"`
+	HomeTeamName      string                  `json:"home_team_name"`
+	AwayTeamName      string                  `json:"away_team_name"`
+	HomeWin           float64                 `json:"home_win"`
+	Draw              float64                 `json:"draw"`
+	AwayWin           float64                 `json:"away_win"`
+	Odds              DecimalOdds             `json:"odds"`
+	ExpectedHomeGoals float64                 `json:"expected_home_goals"`
+	ExpectedAwayGoals float64                 `json:"expected_away_goals"`
+	MostLikelyScores  []*ScorelineProbability `json:"most_likely_scores"`
+	ScoreMatrix       [][]float64             `json:"score_matrix"` // Indexed by home goals, then away goals
+}
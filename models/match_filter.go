@@ -0,0 +1,88 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Venues of a team in a match filter
+const (
+	VenueHome = "home"
+	VenueAway = "away"
+)
+
+// Sort orders of match listings; prefix with "-" for descending
+const (
+	MatchSortWeek     = "week" // Week, then ID
+	MatchSortID       = "id"
+	MatchSortPlayedAt = "played_at" // Unplayed matches last
+	MatchSortGoals    = "goals"     // Total goals
+)
+
+// Page size limits of match listings
+const (
+	DefaultMatchPageSize = 100
+	MaxMatchPageSize     = 500
+)
+
+// MatchFilter selects, orders and pages matches. Zero values do not filter.
+type MatchFilter struct {
+	TeamID     int
+	OpponentID int    // Only TeamID's matches against this team
+	Venue      string // VenueHome or VenueAway for TeamID's home or away matches only
+	Played     *bool
+	EditedOnly bool
+	WeekFrom   int
+	WeekTo     int
+	PlayedFrom time.Time // Inclusive
+	PlayedTo   time.Time // Exclusive
+	Sort       string    // One of the MatchSort values
+	Descending bool
+	Page       int // 1-based
+	PageSize   int
+}
+
+// Validate checks that the filter's ranges and options make sense, filling in paging defaults
+func (f *MatchFilter) Validate() []*FieldError {
+	var errs []*FieldError
+	if f.Venue != "" && f.Venue != VenueHome && f.Venue != VenueAway {
+		errs = append(errs, &FieldError{"query.venue", "must be home or away"})
+	}
+	if f.Venue != "" && f.TeamID == 0 {
+		errs = append(errs, &FieldError{"query.venue", "needs a team"})
+	}
+	if f.OpponentID != 0 && (f.TeamID == 0 || f.OpponentID == f.TeamID) {
+		errs = append(errs, &FieldError{"query.opponent", "needs a different team"})
+	}
+	if f.WeekFrom < 0 || f.WeekTo < 0 {
+		errs = append(errs, &FieldError{"query.week_from", "weeks must be positive"})
+	}
+	if f.WeekFrom > 0 && f.WeekTo > 0 && f.WeekFrom > f.WeekTo {
+		errs = append(errs, &FieldError{"query.week_from", "must not be after week_to"})
+	}
+	if !f.PlayedFrom.IsZero() && !f.PlayedTo.IsZero() && !f.PlayedFrom.Before(f.PlayedTo) {
+		errs = append(errs, &FieldError{"query.from", "must be before to"})
+	}
+
+	switch f.Sort {
+	case "":
+		f.Sort = MatchSortWeek
+	case MatchSortWeek, MatchSortID, MatchSortPlayedAt, MatchSortGoals:
+	default:
+		errs = append(errs, &FieldError{"query.sort", fmt.Sprintf("must be one of %s, %s, %s or %s", MatchSortWeek, MatchSortID, MatchSortPlayedAt, MatchSortGoals)})
+	}
+
+	if f.Page == 0 {
+		f.Page = 1
+	}
+	if f.Page < 1 {
+		errs = append(errs, &FieldError{"query.page", "must be at least 1"})
+	}
+	if f.PageSize == 0 {
+		f.PageSize = DefaultMatchPageSize
+	}
+	if f.PageSize < 1 || f.PageSize > MaxMatchPageSize {
+		errs = append(errs, &FieldError{"query.page_size", fmt.Sprintf("must be between 1 and %d", MaxMatchPageSize)})
+	}
+	return errs
+}
@@ -0,0 +1,34 @@
+package models
+
+import "strconv"
+
+// TeamOutlook represents what a team can still mathematically achieve this season
+type TeamOutlook struct {
+	TeamID          int    `json:"team_id"`
+	TeamName        string `json:"team_name"`
+	Points          int    `json:"points"`
+	Remaining       int    `json:"remaining"`
+	MinPoints       int    `json:"min_points"`
+	MaxPoints       int    `json:"max_points"`
+	BestPosition    int    `json:"best_position"`
+	WorstPosition   int    `json:"worst_position"`
+	TitleClinched   bool   `json:"title_clinched"`
+	TitleEliminated bool   `json:"title_eliminated"`
+	TopN            int    `json:"top_n"`
+	TopNClinched    bool   `json:"top_n_clinched"`
+	TopNEliminated  bool   `json:"top_n_eliminated"`
+	MagicNumber     *int   `json:"magic_number"` // Points still needed to clinch the title, nil when out of reach
+}
+
+// Status returns the table marker for the outlook: "champion", "top_N" or "eliminated"
+func (o *TeamOutlook) Status() string {
+	switch {
+	case o.TitleClinched:
+		return "champion"
+	case o.TopNClinched:
+		return "top_" + strconv.Itoa(o.TopN)
+	case o.TitleEliminated:
+		return "eliminated"
+	}
+	return ""
+}
@@ -0,0 +1,20 @@
+package models
+
+// ProblemContentType is the media type of problem details responses
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details response, used for every API error
+type Problem struct {
+	Type     string        `json:"type"`  // "about:blank": the status code says it all
+	Title    string        `json:"title"` // Text of the status code
+	Status   int           `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Instance string        `json:"instance,omitempty"` // Path of the request
+	Errors   []*FieldError `json:"errors,omitempty"`   // Every problem with the request's input
+}
+
+// FieldError describes one invalid part of a request
+type FieldError struct {
+	Location string `json:"location"` // Such as body.home_team_goals or query.timeout
+	Message  string `json:"message"`
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Input limits enforced by the request types
+const (
+	MinTeamStrength = 1
+	MaxTeamStrength = 10
+	MaxNameLength   = 100
+	MaxGoals        = 99
+	MaxLeagueWeeks  = 100
+	MaxSeasonLength = 20
+)
+
+// TeamRequest is the body of a team create or update. Standings such as points
+// are only changed by playing matches, so they cannot be set here.
+type TeamRequest struct {
+	Name     string   `json:"name"`
+	Strength int      `json:"strength"`
+	Attack   *float64 `json:"attack,omitempty"`
+	Defence  *float64 `json:"defence,omitempty"`
+}
+
+// Validate checks the team's fields, trimming the name
+func (r *TeamRequest) Validate() []*FieldError {
+	var errs []*FieldError
+	r.Name = strings.TrimSpace(r.Name)
+	errs = append(errs, validateName("body.name", r.Name)...)
+	if r.Strength < MinTeamStrength || r.Strength > MaxTeamStrength {
+		errs = append(errs, &FieldError{"body.strength", fmt.Sprintf("must be between %d and %d", MinTeamStrength, MaxTeamStrength)})
+	}
+	if r.Attack != nil && *r.Attack <= 0 {
+		errs = append(errs, &FieldError{"body.attack", "must be greater than 0"})
+	}
+	if r.Defence != nil && *r.Defence <= 0 {
+		errs = append(errs, &FieldError{"body.defence", "must be greater than 0"})
+	}
+	return errs
+}
+
+// Apply copies the request onto a team, keeping its standings. Ratings that are
+// not given keep their current value, or the league average for a new team.
+func (r *TeamRequest) Apply(team *Team) {
+	team.Name = r.Name
+	team.Strength = r.Strength
+	if r.Attack != nil {
+		team.Attack = *r.Attack
+	}
+	if r.Defence != nil {
+		team.Defence = *r.Defence
+	}
+}
+
+// MatchResultRequest is the body of a match result entry
+type MatchResultRequest struct {
+	HomeTeamGoals *int `json:"home_team_goals"`
+	AwayTeamGoals *int `json:"away_team_goals"`
+}
+
+// Validate checks that both scores are given and in range
+func (r *MatchResultRequest) Validate() []*FieldError {
+	var errs []*FieldError
+	errs = append(errs, validateGoals("body.home_team_goals", r.HomeTeamGoals)...)
+	errs = append(errs, validateGoals("body.away_team_goals", r.AwayTeamGoals)...)
+	return errs
+}
+
+// LeagueRequest is the body of a league creation
+type LeagueRequest struct {
+	Name                string `json:"name"`
+	Season              string `json:"season"`
+	TotalWeeks          int    `json:"total_weeks"`
+	PredictionRule      string `json:"prediction_rule"`
+	PredictionThreshold *int   `json:"prediction_threshold"`
+}
+
+// League returns the league the request describes, starting at week 1.
+// Without a prediction rule the league keeps the original week 4 rule.
+func (r *LeagueRequest) League() *League {
+	league := &League{
+		Name:           strings.TrimSpace(r.Name),
+		Season:         strings.TrimSpace(r.Season),
+		CurrentWeek:    1,
+		TotalWeeks:     r.TotalWeeks,
+		PredictionRule: r.PredictionRule,
+	}
+	if league.PredictionRule == "" {
+		league.PredictionRule = PredictionRuleMinWeeks
+		league.PredictionThreshold = 4
+	}
+	if r.PredictionThreshold != nil {
+		league.PredictionThreshold = *r.PredictionThreshold
+	}
+	return league
+}
+
+// Validate checks the league's name, season, length and prediction rule
+func (r *LeagueRequest) Validate() []*FieldError {
+	league := r.League()
+
+	var errs []*FieldError
+	errs = append(errs, validateName("body.name", league.Name)...)
+	if utf8.RuneCountInString(league.Season) > MaxSeasonLength {
+		errs = append(errs, &FieldError{"body.season", fmt.Sprintf("must be at most %d characters long", MaxSeasonLength)})
+	}
+	if league.TotalWeeks < 1 || league.TotalWeeks > MaxLeagueWeeks {
+		errs = append(errs, &FieldError{"body.total_weeks", fmt.Sprintf("must be between 1 and %d", MaxLeagueWeeks)})
+	}
+	if err := league.ValidatePredictionRule(); err != nil {
+		errs = append(errs, &FieldError{"body.prediction_rule", err.Error()})
+	}
+	return errs
+}
+
+// PredictionRuleRequest is the body of a prediction rule change
+type PredictionRuleRequest struct {
+	PredictionRule      string `json:"prediction_rule"`
+	PredictionThreshold int    `json:"prediction_threshold"`
+}
+
+// Validate checks that the rule and its threshold are usable
+func (r *PredictionRuleRequest) Validate() []*FieldError {
+	league := &League{PredictionRule: r.PredictionRule, PredictionThreshold: r.PredictionThreshold}
+	if err := league.ValidatePredictionRule(); err != nil {
+		return []*FieldError{{"body.prediction_rule", err.Error()}}
+	}
+	return nil
+}
+
+// validateName checks that a name is present and not too long
+func validateName(location, name string) []*FieldError {
+	if name == "" {
+		return []*FieldError{{location, "is required"}}
+	}
+	if NameTooLong(name) {
+		return []*FieldError{{location, fmt.Sprintf("must be at most %d characters long", MaxNameLength)}}
+	}
+	return nil
+}
+
+// NameTooLong returns true if a team, league or scenario name is longer than MaxNameLength
+func NameTooLong(name string) bool {
+	return utf8.RuneCountInString(name) > MaxNameLength
+}
+
+// validateGoals checks that a score is given and in range
+func validateGoals(location string, goals *int) []*FieldError {
+	if goals == nil {
+		return []*FieldError{{location, "is required"}}
+	}
+	if *goals < 0 || *goals > MaxGoals {
+		return []*FieldError{{location, fmt.Sprintf("must be between 0 and %d", MaxGoals)}}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// PinnedResult fixes the score of an unplayed match within a scenario
+type PinnedResult struct {
+	MatchID       int `json:"match_id"`
+	HomeTeamGoals int `json:"home_team_goals"`
+	AwayTeamGoals int `json:"away_team_goals"`
+}
+
+// Scenario represents a saved what-if question about the rest of the season
+type Scenario struct {
+	ID            int             `json:"id" db:"id"`
+	Name          string          `json:"name" db:"name"`
+	PinnedResults []*PinnedResult `json:"pinned_results" db:"pinned_results"`
+	Runs          int             `json:"runs" db:"runs"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+}
+
+// ScenarioResult represents a scenario together with its simulated table distribution
+type ScenarioResult struct {
+	Scenario       *Scenario          `json:"scenario"`
+	Distribution   *TableDistribution `json:"distribution"`
+	SkippedMatches []int              `json:"skipped_matches"` // Pinned matches left out because they have been played since the scenario was saved
+}
@@ -12,6 +12,9 @@ type Team struct {
 	GoalDifference int    `json:"goal_difference" db:"goal_difference"`
 	Points        int    `json:"points" db:"points"`
 	Strength      int    `json:"strength" db:"strength"` // 1-10 scale to determine team's strength
+	Attack        float64 `json:"attack" db:"attack"`   // Fitted attack rating, 1.0 is league average
+	Defence       float64 `json:"defence" db:"defence"` // Fitted defence rating, 1.0 is league average
+	Version       int     `json:"version" db:"version"` // Raised by every update, for optimistic concurrency
 }
 
 // Calculate points based on Premier League rules
@@ -42,4 +45,5 @@ type TeamStats struct {
 	GoalsAgainst  int    `json:"goals_against" db:"goals_against"`
 	GoalDifference int    `json:"goal_difference" db:"goal_difference"`
 	Points        int    `json:"points" db:"points"`
+	Status        string `json:"status,omitempty"` // Clinch marker from the season outlook
 } 
\ No newline at end of file
@@ -0,0 +1,187 @@
+package models
+
+import "time"
+
+// Match results from one team's point of view
+const (
+	ResultWin  = "W"
+	ResultDraw = "D"
+	ResultLoss = "L"
+)
+
+// DefaultFormMatches is the number of recent results in a team's form
+const DefaultFormMatches = 5
+
+// TeamResult represents a played match from one team's point of view
+type TeamResult struct {
+	MatchID      int       `json:"match_id"`
+	Week         int       `json:"week"`
+	Venue        string    `json:"venue"` // VenueHome or VenueAway
+	OpponentID   int       `json:"opponent_id"`
+	OpponentName string    `json:"opponent_name"`
+	GoalsFor     int       `json:"goals_for"`
+	GoalsAgainst int       `json:"goals_against"`
+	Result       string    `json:"result"` // ResultWin, ResultDraw or ResultLoss
+	Points       int       `json:"points"`
+	TotalPoints  *int      `json:"total_points,omitempty"` // Running points total after this match, in a team's match list
+	PlayedAt     time.Time `json:"played_at,omitempty"`
+	IsEdited     bool      `json:"is_edited"`
+}
+
+// TeamFixture represents an unplayed match from one team's point of view
+type TeamFixture struct {
+	MatchID      int    `json:"match_id"`
+	Week         int    `json:"week"`
+	Venue        string `json:"venue"` // VenueHome or VenueAway
+	OpponentID   int    `json:"opponent_id"`
+	OpponentName string `json:"opponent_name"`
+}
+
+// TeamRecord represents a team's results over a set of matches
+type TeamRecord struct {
+	Played       int `json:"played"`
+	Won          int `json:"won"`
+	Drawn        int `json:"drawn"`
+	Lost         int `json:"lost"`
+	GoalsFor     int `json:"goals_for"`
+	GoalsAgainst int `json:"goals_against"`
+	Points       int `json:"points"`
+}
+
+// Add counts a result in the record
+func (r *TeamRecord) Add(result *TeamResult) {
+	r.Played++
+	r.GoalsFor += result.GoalsFor
+	r.GoalsAgainst += result.GoalsAgainst
+	r.Points += result.Points
+	switch result.Result {
+	case ResultWin:
+		r.Won++
+	case ResultDraw:
+		r.Drawn++
+	default:
+		r.Lost++
+	}
+}
+
+// TeamMatchSummary summarizes a team's results
+type TeamMatchSummary struct {
+	Form                  string     `json:"form"` // Results of the last matches, oldest first, such as "WWDLW"
+	FormPoints            int        `json:"form_points"`
+	Overall               TeamRecord `json:"overall"`
+	Home                  TeamRecord `json:"home"`
+	Away                  TeamRecord `json:"away"`
+	LongestWinStreak      int        `json:"longest_win_streak"`
+	LongestUnbeatenStreak int        `json:"longest_unbeaten_streak"`
+	LongestLosingStreak   int        `json:"longest_losing_streak"`
+}
+
+// TeamMatches represents a team's results, upcoming fixtures and a summary of its results
+type TeamMatches struct {
+	TeamID   int              `json:"team_id"`
+	TeamName string           `json:"team_name"`
+	Results  []*TeamResult    `json:"results"`
+	Fixtures []*TeamFixture   `json:"fixtures"`
+	Summary  TeamMatchSummary `json:"summary"`
+}
+
+// ResultFor returns a played match from the point of view of one of its teams
+func (m *Match) ResultFor(teamID int) *TeamResult {
+	result := &TeamResult{
+		MatchID:      m.ID,
+		Week:         m.Week,
+		Venue:        VenueHome,
+		OpponentID:   m.AwayTeamID,
+		OpponentName: m.AwayTeamName,
+		GoalsFor:     m.HomeTeamGoals,
+		GoalsAgainst: m.AwayTeamGoals,
+		PlayedAt:     m.PlayedAt,
+		IsEdited:     m.IsEdited,
+	}
+	if teamID == m.AwayTeamID {
+		result.Venue = VenueAway
+		result.OpponentID = m.HomeTeamID
+		result.OpponentName = m.HomeTeamName
+		result.GoalsFor, result.GoalsAgainst = m.AwayTeamGoals, m.HomeTeamGoals
+	}
+
+	switch {
+	case result.GoalsFor > result.GoalsAgainst:
+		result.Result, result.Points = ResultWin, 3
+	case result.GoalsFor == result.GoalsAgainst:
+		result.Result, result.Points = ResultDraw, 1
+	default:
+		result.Result = ResultLoss
+	}
+	return result
+}
+
+// FixtureFor returns an unplayed match from the point of view of one of its teams
+func (m *Match) FixtureFor(teamID int) *TeamFixture {
+	if teamID == m.AwayTeamID {
+		return &TeamFixture{MatchID: m.ID, Week: m.Week, Venue: VenueAway, OpponentID: m.HomeTeamID, OpponentName: m.HomeTeamName}
+	}
+	return &TeamFixture{MatchID: m.ID, Week: m.Week, Venue: VenueHome, OpponentID: m.AwayTeamID, OpponentName: m.AwayTeamName}
+}
+
+// DefaultRecentMeetings is the number of recent results in a head-to-head record
+const DefaultRecentMeetings = 5
+
+// HeadToHead represents the record of the meetings between two teams, from the first team's point of view
+type HeadToHead struct {
+	TeamID             int           `json:"team_id"`
+	TeamName           string        `json:"team_name"`
+	OpponentID         int           `json:"opponent_id"`
+	OpponentName       string        `json:"opponent_name"`
+	Played             int           `json:"played"`
+	TeamWins           int           `json:"team_wins"`
+	OpponentWins       int           `json:"opponent_wins"`
+	Draws              int           `json:"draws"`
+	TeamGoals          int           `json:"team_goals"`
+	OpponentGoals      int           `json:"opponent_goals"`
+	BiggestTeamWin     *TeamResult   `json:"biggest_team_win"`     // Nil when the team never won
+	BiggestOpponentWin *TeamResult   `json:"biggest_opponent_win"` // Nil when the opponent never won
+	RecentResults      []*TeamResult `json:"recent_results"`       // Most recent first
+	NextMeeting        *MatchOdds    `json:"next_meeting"`         // Without a match ID when no meeting is scheduled
+}
+
+// Add counts a played meeting in the record
+func (h *HeadToHead) Add(result *TeamResult) {
+	h.Played++
+	h.TeamGoals += result.GoalsFor
+	h.OpponentGoals += result.GoalsAgainst
+	switch result.Result {
+	case ResultWin:
+		h.TeamWins++
+		if result.biggerWinThan(h.BiggestTeamWin) {
+			h.BiggestTeamWin = result
+		}
+	case ResultDraw:
+		h.Draws++
+	default:
+		h.OpponentWins++
+		if result.biggerWinThan(h.BiggestOpponentWin) {
+			h.BiggestOpponentWin = result
+		}
+	}
+}
+
+// biggerWinThan reports whether a result has a wider margin than another, or as wide with more goals
+func (r *TeamResult) biggerWinThan(other *TeamResult) bool {
+	if other == nil {
+		return true
+	}
+	margin, otherMargin := abs(r.GoalsFor-r.GoalsAgainst), abs(other.GoalsFor-other.GoalsAgainst)
+	if margin != otherMargin {
+		return margin > otherMargin
+	}
+	return r.GoalsFor+r.GoalsAgainst > other.GoalsFor+other.GoalsAgainst
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// The default tenant serves requests that do not name a tenant
+const (
+	DefaultTenantID   = 1
+	DefaultTenantSlug = "default"
+)
+
+// Tenant represents a workspace with its own teams, matches and leagues
+type Tenant struct {
+	ID        int       `json:"id" db:"id"`
+	Slug      string    `json:"slug" db:"slug"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
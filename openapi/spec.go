@@ -0,0 +1,265 @@
+// Package openapi holds the API's OpenAPI 3 document and validates requests against it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var document []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// Document returns the OpenAPI document served at /api/openapi.json
+func Document() []byte {
+	return document
+}
+
+// DocsPage returns the HTML page that renders the document with Swagger UI
+func DocsPage() []byte {
+	return docsPage
+}
+
+// Schema is the subset of an OpenAPI schema object that requests are validated against
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Nullable             bool               `json:"nullable"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	AllOf                []*Schema          `json:"allOf"`
+	Enum                 []interface{}      `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum"`
+	ExclusiveMaximum     bool               `json:"exclusiveMaximum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+
+	pattern *regexp.Regexp
+}
+
+// Parameter is a path, query or header parameter of an operation
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// MediaType describes one content type of a request body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// RequestBody describes the body an operation accepts
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// mediaTypes returns the content types the body may have, in a stable order
+func (b *RequestBody) mediaTypes() []string {
+	types := make([]string, 0, len(b.Content))
+	for mediaType := range b.Content {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Operation is one method on one path of the API
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+// Spec is a loaded OpenAPI document, ready to validate requests
+type Spec struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+	} `json:"components"`
+
+	routes []*route
+}
+
+// route matches request paths to an operation
+type route struct {
+	method    string
+	segments  []string // "{name}" segments match any value
+	static    int      // Number of literal segments, so /teams/calibrate wins over /teams/{id}
+	operation *Operation
+}
+
+// Load parses an OpenAPI document, resolving parameter references and compiling patterns
+func Load(data []byte) (*Spec, error) {
+	spec := &Spec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+
+	for path, operations := range spec.Paths {
+		for method, operation := range operations {
+			for i, parameter := range operation.Parameters {
+				if parameter.Ref == "" {
+					continue
+				}
+				resolved, ok := spec.Components.Parameters[strings.TrimPrefix(parameter.Ref, "#/components/parameters/")]
+				if !ok {
+					return nil, fmt.Errorf("%s %s: unknown parameter %s", method, path, parameter.Ref)
+				}
+				operation.Parameters[i] = resolved
+			}
+
+			r := &route{method: strings.ToUpper(method), segments: splitPath(path), operation: operation}
+			for _, segment := range r.segments {
+				if !strings.HasPrefix(segment, "{") {
+					r.static++
+				}
+			}
+			spec.routes = append(spec.routes, r)
+		}
+	}
+	sort.SliceStable(spec.routes, func(i, j int) bool {
+		return spec.routes[i].static > spec.routes[j].static
+	})
+
+	if err := spec.compile(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// MustLoad loads the embedded document, panicking if it is invalid
+func MustLoad() *Spec {
+	spec, err := Load(document)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+// compile compiles the patterns of every schema in the document and checks that every
+// schema reference can be resolved, so that a broken document fails at startup
+func (s *Spec) compile() error {
+	var visit func(schema *Schema) error
+	visit = func(schema *Schema) error {
+		if schema == nil {
+			return nil
+		}
+		if schema.Ref != "" {
+			name := strings.TrimPrefix(schema.Ref, schemaRefPrefix)
+			if _, ok := s.Components.Schemas[name]; !ok || name == schema.Ref {
+				return fmt.Errorf("unknown schema %s", schema.Ref)
+			}
+		}
+		if schema.Pattern != "" && schema.pattern == nil {
+			pattern, err := regexp.Compile(schema.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", schema.Pattern, err)
+			}
+			schema.pattern = pattern
+		}
+		for _, property := range schema.Properties {
+			if err := visit(property); err != nil {
+				return err
+			}
+		}
+		for _, part := range schema.AllOf {
+			if err := visit(part); err != nil {
+				return err
+			}
+		}
+		return visit(schema.Items)
+	}
+
+	for _, schema := range s.Components.Schemas {
+		if err := visit(schema); err != nil {
+			return err
+		}
+	}
+	for _, parameter := range s.Components.Parameters {
+		if err := visit(parameter.Schema); err != nil {
+			return err
+		}
+	}
+	for _, operations := range s.Paths {
+		for _, operation := range operations {
+			for _, parameter := range operation.Parameters {
+				if err := visit(parameter.Schema); err != nil {
+					return err
+				}
+			}
+			if operation.RequestBody == nil {
+				continue
+			}
+			for _, mediaType := range operation.RequestBody.Content {
+				if err := visit(mediaType.Schema); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Find returns the operation for a request method and path with its path parameters,
+// or nil when the document has no such operation
+func (s *Spec) Find(method, path string) (*Operation, map[string]string) {
+	segments := splitPath(path)
+	for _, r := range s.routes {
+		if r.method != method || len(r.segments) != len(segments) {
+			continue
+		}
+
+		params := make(map[string]string)
+		matched := true
+		for i, segment := range r.segments {
+			if strings.HasPrefix(segment, "{") {
+				params[strings.Trim(segment, "{}")] = segments[i]
+			} else if segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return r.operation, params
+		}
+	}
+	return nil, nil
+}
+
+// schemaRefPrefix starts every schema reference; only references into the document's components are supported
+const schemaRefPrefix = "#/components/schemas/"
+
+// resolve follows a schema reference into the document's components. Load has checked every reference.
+func (s *Spec) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.Components.Schemas[strings.TrimPrefix(schema.Ref, schemaRefPrefix)]
+	}
+	return schema
+}
+
+// splitPath splits a path into its segments, ignoring a trailing slash
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,314 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/user/footballsim/models"
+)
+
+// Request is the part of an HTTP request that is validated
+type Request struct {
+	Method      string
+	Path        string
+	Query       url.Values
+	ContentType string
+	Body        []byte
+}
+
+// ErrUnsupportedMediaType is returned for a request body in a format its operation does not accept
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Validate checks a request's path and query parameters and its JSON body against the
+// operation it is for. It returns nil for requests the document does not describe.
+// Bodies in other formats the operation accepts, such as CSV uploads, are left to the handlers;
+// a body in a format it does not accept returns ErrUnsupportedMediaType.
+func (s *Spec) Validate(r *Request) ([]*models.FieldError, error) {
+	operation, pathParams := s.Find(r.Method, r.Path)
+	if operation == nil {
+		return nil, nil
+	}
+
+	var errs []*models.FieldError
+	for _, parameter := range operation.Parameters {
+		var value string
+		var present bool
+		switch parameter.In {
+		case "path":
+			value, present = pathParams[parameter.Name]
+		case "query":
+			present = r.Query.Has(parameter.Name)
+			value = r.Query.Get(parameter.Name)
+		default:
+			continue
+		}
+
+		location := parameter.In + "." + parameter.Name
+		if !present {
+			if parameter.Required {
+				errs = append(errs, invalid(location, "is required"))
+			}
+			continue
+		}
+		errs = append(errs, s.validateParameter(parameter.Schema, value, location)...)
+	}
+
+	if operation.RequestBody != nil {
+		bodyErrs, err := s.validateBody(operation.RequestBody, r.ContentType, r.Body)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, bodyErrs...)
+	}
+	return errs, nil
+}
+
+// validateParameter converts a parameter's text to its schema type and validates it
+func (s *Spec) validateParameter(schema *Schema, text, location string) []*models.FieldError {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	var value interface{} = text
+	switch schema.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return []*models.FieldError{invalid(location, "must be a "+schemaTypeName(schema.Type))}
+		}
+		value = json.Number(text)
+	case "boolean":
+		parsed, err := strconv.ParseBool(text)
+		if err != nil {
+			return []*models.FieldError{invalid(location, "must be true or false")}
+		}
+		value = parsed
+	}
+	return s.validateValue(schema, value, location)
+}
+
+// validateBody checks that a body is in a format the operation accepts, and validates JSON bodies
+// against the operation's JSON schema. A body without a Content-Type is taken to be JSON.
+func (s *Spec) validateBody(body *RequestBody, contentType string, data []byte) ([]*models.FieldError, error) {
+	empty := len(bytes.TrimSpace(data)) == 0
+
+	mediaType := "application/json"
+	if contentType != "" && !empty {
+		parsed, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedMediaType, contentType)
+		}
+		// Structured syntax suffixes such as application/problem+json are JSON too
+		if strings.HasSuffix(parsed, "+json") {
+			parsed = "application/json"
+		}
+		if _, ok := body.Content[parsed]; !ok {
+			return nil, fmt.Errorf("%w: %s; expected %s", ErrUnsupportedMediaType, parsed, strings.Join(body.mediaTypes(), ", "))
+		}
+		mediaType = parsed
+	}
+
+	// Other formats are left to the handlers
+	content, ok := body.Content[mediaType]
+	if mediaType != "application/json" || !ok || content.Schema == nil {
+		return nil, nil
+	}
+
+	if empty {
+		if body.Required {
+			return []*models.FieldError{invalid("body", "a JSON body is required")}, nil
+		}
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return []*models.FieldError{invalid("body", "is not valid JSON: "+err.Error())}, nil
+	}
+	return s.validateValue(content.Schema, value, "body"), nil
+}
+
+// validateValue validates a decoded JSON value against a schema
+func (s *Spec) validateValue(schema *Schema, value interface{}, location string) []*models.FieldError {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	var errs []*models.FieldError
+	for _, part := range schema.AllOf {
+		errs = append(errs, s.validateValue(part, value, location)...)
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return errs
+		}
+		return append(errs, invalid(location, "must not be null"))
+	}
+
+	if schema.Type != "" && !hasType(value, schema.Type) {
+		return append(errs, invalid(location, "must be "+schemaTypeArticle(schema.Type)))
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(value, schema.Enum) {
+		options := make([]string, len(schema.Enum))
+		for i, option := range schema.Enum {
+			options[i] = fmt.Sprint(option)
+		}
+		errs = append(errs, invalid(location, "must be one of "+strings.Join(options, ", ")))
+	}
+
+	switch value := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(value)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			message := fmt.Sprintf("must be at least %d characters long", *schema.MinLength)
+			if *schema.MinLength == 1 {
+				message = "must not be empty"
+			}
+			errs = append(errs, invalid(location, message))
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			errs = append(errs, invalid(location, fmt.Sprintf("must be at most %d characters long", *schema.MaxLength)))
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(value) {
+			errs = append(errs, invalid(location, "must match "+schema.Pattern))
+		}
+
+	case json.Number:
+		number, _ := value.Float64()
+		if schema.Minimum != nil {
+			if schema.ExclusiveMinimum && number <= *schema.Minimum {
+				errs = append(errs, invalid(location, "must be greater than "+formatNumber(*schema.Minimum)))
+			} else if number < *schema.Minimum {
+				errs = append(errs, invalid(location, "must be at least "+formatNumber(*schema.Minimum)))
+			}
+		}
+		if schema.Maximum != nil {
+			if schema.ExclusiveMaximum && number >= *schema.Maximum {
+				errs = append(errs, invalid(location, "must be less than "+formatNumber(*schema.Maximum)))
+			} else if number > *schema.Maximum {
+				errs = append(errs, invalid(location, "must be at most "+formatNumber(*schema.Maximum)))
+			}
+		}
+
+	case []interface{}:
+		if schema.MinItems != nil && len(value) < *schema.MinItems {
+			errs = append(errs, invalid(location, fmt.Sprintf("must have at least %d items", *schema.MinItems)))
+		}
+		if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+			errs = append(errs, invalid(location, fmt.Sprintf("must have at most %d items", *schema.MaxItems)))
+		}
+		if schema.Items != nil {
+			for i, item := range value {
+				errs = append(errs, s.validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", location, i))...)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				errs = append(errs, invalid(location+"."+name, "is required"))
+			}
+		}
+
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				if string(schema.AdditionalProperties) == "false" {
+					errs = append(errs, invalid(location+"."+name, "is not a known field"))
+				}
+				continue
+			}
+			errs = append(errs, s.validateValue(property, value[name], location+"."+name)...)
+		}
+	}
+
+	return errs
+}
+
+// invalid returns the error for one invalid part of a request
+func invalid(location, message string) *models.FieldError {
+	return &models.FieldError{Location: location, Message: message}
+}
+
+// hasType reports whether a decoded JSON value has the given schema type
+func hasType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		parsed, err := number.Float64()
+		return err == nil && parsed == math.Trunc(parsed) && math.Abs(parsed) <= math.MaxInt32
+	}
+	return true
+}
+
+// inEnum reports whether a value is one of the enum's options
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, option := range enum {
+		if fmt.Sprint(option) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypeName returns a readable name for a schema type
+func schemaTypeName(schemaType string) string {
+	switch schemaType {
+	case "integer":
+		return "whole number"
+	case "object":
+		return "JSON object"
+	}
+	return schemaType
+}
+
+// schemaTypeArticle returns the readable name of a schema type with its article
+func schemaTypeArticle(schemaType string) string {
+	name := schemaTypeName(schemaType)
+	if strings.ContainsAny(name[:1], "aeiou") {
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// formatNumber formats a schema bound without a needless fraction
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
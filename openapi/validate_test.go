@@ -0,0 +1,249 @@
+package openapi
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/user/footballsim/models"
+)
+
+// testDocument describes one operation whose body schema is reached through a $ref
+const testDocument = `{
+	"paths": {
+		"/api/teams/{id}": {
+			"put": {
+				"parameters": [
+					{"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1}},
+					{"$ref": "#/components/parameters/View"}
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {"schema": {"$ref": "#/components/schemas/TeamInput"}},
+						"text/csv": {"schema": {"type": "string"}}
+					}
+				}
+			}
+		}
+	},
+	"components": {
+		"parameters": {
+			"View": {"name": "view", "in": "query", "schema": {"type": "string", "enum": ["overall", "home", "away"]}}
+		},
+		"schemas": {
+			"TeamInput": {
+				"type": "object",
+				"required": ["name", "strength"],
+				"additionalProperties": false,
+				"properties": {
+					"name": {"type": "string", "minLength": 1},
+					"strength": {"type": "integer", "minimum": 1, "maximum": 10},
+					"style": {"type": "string", "enum": ["attacking", "defensive"]},
+					"coach": {"$ref": "#/components/schemas/Coach"}
+				}
+			},
+			"Coach": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {"name": {"type": "string"}}
+			}
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	spec, err := Load([]byte(testDocument))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		query url.Values
+		body  string
+		want  []*models.FieldError
+	}{
+		{
+			name: "valid",
+			path: "/api/teams/1",
+			body: `{"name": "Arsenal", "strength": 8, "style": "attacking", "coach": {"name": "Mikel"}}`,
+		},
+		{
+			name: "required properties",
+			path: "/api/teams/1",
+			body: `{}`,
+			want: []*models.FieldError{
+				{Location: "body.name", Message: "is required"},
+				{Location: "body.strength", Message: "is required"},
+			},
+		},
+		{
+			name: "required body",
+			path: "/api/teams/1",
+			want: []*models.FieldError{{Location: "body", Message: "a JSON body is required"}},
+		},
+		{
+			name: "type of properties",
+			path: "/api/teams/1",
+			body: `{"name": 8, "strength": 7.5}`,
+			want: []*models.FieldError{
+				{Location: "body.name", Message: "must be a string"},
+				{Location: "body.strength", Message: "must be a whole number"},
+			},
+		},
+		{
+			name: "type of body",
+			path: "/api/teams/1",
+			body: `["Arsenal"]`,
+			want: []*models.FieldError{{Location: "body", Message: "must be a JSON object"}},
+		},
+		{
+			name: "type of path parameter",
+			path: "/api/teams/first",
+			body: `{"name": "Arsenal", "strength": 8}`,
+			want: []*models.FieldError{{Location: "path.id", Message: "must be a whole number"}},
+		},
+		{
+			name: "enum property",
+			path: "/api/teams/1",
+			body: `{"name": "Arsenal", "strength": 8, "style": "chaotic"}`,
+			want: []*models.FieldError{{Location: "body.style", Message: "must be one of attacking, defensive"}},
+		},
+		{
+			name:  "enum parameter from a $ref",
+			path:  "/api/teams/1",
+			query: url.Values{"view": {"form"}},
+			body:  `{"name": "Arsenal", "strength": 8}`,
+			want:  []*models.FieldError{{Location: "query.view", Message: "must be one of overall, home, away"}},
+		},
+		{
+			name: "nested schema from a $ref",
+			path: "/api/teams/1",
+			body: `{"name": "Arsenal", "strength": 8, "coach": {"name": null}}`,
+			want: []*models.FieldError{{Location: "body.coach.name", Message: "must not be null"}},
+		},
+		{
+			name: "required property of a $ref",
+			path: "/api/teams/1",
+			body: `{"name": "Arsenal", "strength": 8, "coach": {}}`,
+			want: []*models.FieldError{{Location: "body.coach.name", Message: "is required"}},
+		},
+		{
+			name: "bounds and unknown fields",
+			path: "/api/teams/1",
+			body: `{"name": "", "strength": 11, "colour": "red"}`,
+			want: []*models.FieldError{
+				{Location: "body.colour", Message: "is not a known field"},
+				{Location: "body.name", Message: "must not be empty"},
+				{Location: "body.strength", Message: "must be at most 10"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := spec.Validate(&Request{
+				Method:      "PUT",
+				Path:        tt.path,
+				Query:       tt.query,
+				ContentType: "application/json",
+				Body:        []byte(tt.body),
+			})
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if got, want := formatErrors(errs), formatErrors(tt.want); got != want {
+				t.Errorf("got errors\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateMediaType(t *testing.T) {
+	spec, err := Load([]byte(testDocument))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		unsupported bool
+	}{
+		{name: "JSON", contentType: "application/json; charset=utf-8", body: `{"name": "Arsenal", "strength": 8}`},
+		{name: "JSON suffix", contentType: "application/merge-patch+json", body: `{"name": "Arsenal", "strength": 8}`},
+		{name: "no content type", body: `{"name": "Arsenal", "strength": 8}`},
+		{name: "other accepted type", contentType: "text/csv", body: "name,strength\nArsenal,8"},
+		{name: "unaccepted type", contentType: "application/xml", body: "<team/>", unsupported: true},
+		{name: "malformed type", contentType: "text/", body: "Arsenal", unsupported: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := spec.Validate(&Request{
+				Method:      "PUT",
+				Path:        "/api/teams/1",
+				ContentType: tt.contentType,
+				Body:        []byte(tt.body),
+			})
+			if got := errors.Is(err, ErrUnsupportedMediaType); got != tt.unsupported {
+				t.Fatalf("unsupported media type = %v, want %v (err %v)", got, tt.unsupported, err)
+			}
+			if len(errs) > 0 {
+				t.Errorf("unexpected errors\n%s", formatErrors(errs))
+			}
+		})
+	}
+}
+
+func TestLoadUnknownRef(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+	}{
+		{
+			name:     "body schema",
+			document: `{"paths": {"/x": {"post": {"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Missing"}}}}}}}}`,
+			want:     "unknown schema #/components/schemas/Missing",
+		},
+		{
+			name:     "nested property",
+			document: `{"paths": {}, "components": {"schemas": {"Team": {"type": "object", "properties": {"coach": {"$ref": "#/components/schemas/Coach"}}}}}}`,
+			want:     "unknown schema #/components/schemas/Coach",
+		},
+		{
+			name:     "parameter",
+			document: `{"paths": {"/x": {"get": {"parameters": [{"$ref": "#/components/parameters/Missing"}]}}}}`,
+			want:     "unknown parameter #/components/parameters/Missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]byte(tt.document))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedDocumentLoads(t *testing.T) {
+	if _, err := Load(Document()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+}
+
+// formatErrors lists field errors one per line, so that test failures are readable
+func formatErrors(errs []*models.FieldError) string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Location + ": " + err.Message
+	}
+	return strings.Join(lines, "\n")
+}
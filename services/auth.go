@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/user/footballsim/models"
+)
+
+var (
+	// ErrInvalidAPIKey is returned when a presented API key is unknown
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrInvalidRole is returned when an API key is requested with an unknown role
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+// apiKeyPrefixLength is the number of leading key characters kept to identify a key
+const apiKeyPrefixLength = 8
+
+// AuthService issues and checks API keys
+type AuthService struct {
+	KeyRepo APIKeyRepository
+	// AdminKey is an optional bootstrap key from the environment that always has the admin role
+	AdminKey string
+}
+
+// NewAuthService creates a new auth service
+func NewAuthService(keyRepo APIKeyRepository, adminKey string) *AuthService {
+	return &AuthService{
+		KeyRepo:  keyRepo,
+		AdminKey: adminKey,
+	}
+}
+
+// Authenticate returns the API key record for a presented key
+func (s *AuthService) Authenticate(ctx context.Context, key string) (*models.APIKey, error) {
+	if key == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if s.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.AdminKey)) == 1 {
+		return &models.APIKey{
+			Name: "bootstrap admin",
+			Role: models.RoleAdmin,
+		}, nil
+	}
+
+	apiKey, err := s.KeyRepo.GetByHash(ctx, hashAPIKey(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return apiKey, nil
+}
+
+// CreateKey issues a new API key with the given role in a tenant. The plain key is only returned here.
+func (s *AuthService) CreateKey(ctx context.Context, tenantID int, name, role string) (*models.APIKey, string, error) {
+	if !models.IsValidRole(role) {
+		return nil, "", fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	key := hex.EncodeToString(secret)
+
+	apiKey := &models.APIKey{
+		TenantID: tenantID,
+		Name:     name,
+		Role:     role,
+		Prefix:   key[:apiKeyPrefixLength],
+		KeyHash:  hashAPIKey(key),
+	}
+	if err := s.KeyRepo.Create(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// hashAPIKey returns the stored form of an API key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/user/footballsim/models"
+)
+
+var (
+	// ErrNotEnoughMatches is returned when there are too few results to fit ratings
+	ErrNotEnoughMatches = errors.New("not enough played matches to calibrate team ratings")
+	// ErrInvalidHistoricalData is returned when uploaded historical results cannot be used
+	ErrInvalidHistoricalData = errors.New("invalid historical data")
+)
+
+const (
+	calibrationMaxIterations = 5000
+	calibrationTolerance     = 1e-9
+	// calibrationRidge keeps ratings finite for teams that never scored or never conceded
+	calibrationRidge = 0.01
+)
+
+// Calibrator fits team attack and defence ratings to historical results
+type Calibrator struct {
+	TeamRepo  TeamRepository
+	MatchRepo MatchRepository
+	Lock      LeagueLock
+}
+
+// NewCalibrator creates a new calibrator
+func NewCalibrator(teamRepo TeamRepository, matchRepo MatchRepository, lock LeagueLock) *Calibrator {
+	return &Calibrator{
+		TeamRepo:  teamRepo,
+		MatchRepo: matchRepo,
+		Lock:      lock,
+	}
+}
+
+// lock takes the league lock unless this is a dry run, which changes nothing.
+// Calibration rewrites every team, so it must not interleave with simulations or result edits.
+func (c *Calibrator) lock(ctx context.Context, dryRun bool) (func(), error) {
+	if dryRun {
+		return func() {}, nil
+	}
+	return c.Lock.Lock(ctx)
+}
+
+// CalibrateFromDatabase fits ratings to the matches already played in the database
+func (c *Calibrator) CalibrateFromDatabase(ctx context.Context, dryRun bool) (*models.CalibrationReport, error) {
+	unlock, err := c.lock(ctx, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	matches, err := c.MatchRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	played := make([]*models.Match, 0, len(matches))
+	for _, match := range matches {
+		if match.Played {
+			played = append(played, match)
+		}
+	}
+
+	return c.calibrate(ctx, played, "database", dryRun)
+}
+
+// CalibrateFromCSV fits ratings to historical results read from a CSV file
+func (c *Calibrator) CalibrateFromCSV(ctx context.Context, r io.Reader, dryRun bool) (*models.CalibrationReport, error) {
+	unlock, err := c.lock(ctx, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	teams, err := c.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := ParseHistoricalCSV(r, teams)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.calibrate(ctx, matches, "csv", dryRun)
+}
+
+// Calibrate fits Dixon-Coles attack and defence ratings to the given played matches
+// and, unless dryRun is set, writes the fitted ratings back to the teams
+func (c *Calibrator) Calibrate(ctx context.Context, matches []*models.Match, source string, dryRun bool) (*models.CalibrationReport, error) {
+	unlock, err := c.lock(ctx, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return c.calibrate(ctx, matches, source, dryRun)
+}
+
+// calibrate is Calibrate for callers that already hold the league lock
+func (c *Calibrator) calibrate(ctx context.Context, matches []*models.Match, source string, dryRun bool) (*models.CalibrationReport, error) {
+	teams, err := c.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	teamMap := make(map[int]*models.Team)
+	for _, team := range teams {
+		teamMap[team.ID] = team
+	}
+
+	// Only teams that appear in the results can be rated
+	matchCounts := make(map[int]int)
+	for _, match := range matches {
+		if _, ok := teamMap[match.HomeTeamID]; !ok {
+			return nil, fmt.Errorf("%w: unknown team ID %d", ErrInvalidHistoricalData, match.HomeTeamID)
+		}
+		if _, ok := teamMap[match.AwayTeamID]; !ok {
+			return nil, fmt.Errorf("%w: unknown team ID %d", ErrInvalidHistoricalData, match.AwayTeamID)
+		}
+		matchCounts[match.HomeTeamID]++
+		matchCounts[match.AwayTeamID]++
+	}
+
+	teamIDs := make([]int, 0, len(matchCounts))
+	for id := range matchCounts {
+		teamIDs = append(teamIDs, id)
+	}
+	sort.Ints(teamIDs)
+
+	if len(teamIDs) < 2 || len(matches) < len(teamIDs) {
+		return nil, ErrNotEnoughMatches
+	}
+
+	fit := fitDixonColes(matches, teamIDs)
+
+	report := &models.CalibrationReport{
+		Source:        source,
+		MatchesUsed:   len(matches),
+		HomeAdvantage: math.Exp(fit.home),
+		AverageGoals:  math.Exp(fit.base),
+		Rho:           fit.rho,
+		LogLikelihood: fit.logLikelihood,
+		AIC:           2*float64(fit.freeParameters) - 2*fit.logLikelihood,
+		Iterations:    fit.iterations,
+		Converged:     fit.converged,
+		Ratings:       make([]*models.TeamRating, 0, len(teamIDs)),
+	}
+	report.BrierScore, report.Accuracy = fit.predictiveQuality(matches)
+
+	strengths := fittedStrengths(fit)
+	for _, id := range teamIDs {
+		team := teamMap[id]
+		report.Ratings = append(report.Ratings, &models.TeamRating{
+			TeamID:           team.ID,
+			TeamName:         team.Name,
+			Matches:          matchCounts[id],
+			Attack:           math.Exp(fit.attack[id]),
+			Defence:          math.Exp(fit.defence[id]),
+			Strength:         strengths[id],
+			PreviousStrength: team.Strength,
+		})
+	}
+
+	// Strongest teams first
+	sort.Slice(report.Ratings, func(i, j int) bool {
+		return report.Ratings[i].Attack*report.Ratings[i].Defence > report.Ratings[j].Attack*report.Ratings[j].Defence
+	})
+
+	if dryRun {
+		return report, nil
+	}
+
+	for _, rating := range report.Ratings {
+		team := teamMap[rating.TeamID]
+		team.Attack = rating.Attack
+		team.Defence = rating.Defence
+		team.Strength = rating.Strength
+
+		if err := c.TeamRepo.Update(ctx, team); err != nil {
+			return nil, err
+		}
+	}
+	report.Applied = true
+
+	return report, nil
+}
+
+// ParseHistoricalCSV reads played matches from CSV data with a header row containing
+// home_team, away_team, home_goals and away_goals columns. Team names must match existing teams.
+func ParseHistoricalCSV(r io.Reader, teams []*models.Team) ([]*models.Match, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing header row", ErrInvalidHistoricalData)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"home_team", "away_team", "home_goals", "away_goals"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: missing %q column", ErrInvalidHistoricalData, required)
+		}
+	}
+
+	teamsByName := make(map[string]*models.Team)
+	for _, team := range teams {
+		teamsByName[strings.ToLower(team.Name)] = team
+	}
+
+	matches := make([]*models.Match, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidHistoricalData, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(column string) string {
+			if i := columns[column]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		homeTeam, ok := teamsByName[strings.ToLower(field("home_team"))]
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: unknown home team %q", ErrInvalidHistoricalData, line, field("home_team"))
+		}
+		awayTeam, ok := teamsByName[strings.ToLower(field("away_team"))]
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: unknown away team %q", ErrInvalidHistoricalData, line, field("away_team"))
+		}
+		if homeTeam.ID == awayTeam.ID {
+			return nil, fmt.Errorf("%w: line %d: a team cannot play itself", ErrInvalidHistoricalData, line)
+		}
+
+		homeGoals, err := strconv.Atoi(field("home_goals"))
+		if err != nil || homeGoals < 0 {
+			return nil, fmt.Errorf("%w: line %d: invalid home goals %q", ErrInvalidHistoricalData, line, field("home_goals"))
+		}
+		awayGoals, err := strconv.Atoi(field("away_goals"))
+		if err != nil || awayGoals < 0 {
+			return nil, fmt.Errorf("%w: line %d: invalid away goals %q", ErrInvalidHistoricalData, line, field("away_goals"))
+		}
+
+		matches = append(matches, &models.Match{
+			HomeTeamID:    homeTeam.ID,
+			AwayTeamID:    awayTeam.ID,
+			HomeTeamName:  homeTeam.Name,
+			AwayTeamName:  awayTeam.Name,
+			HomeTeamGoals: homeGoals,
+			AwayTeamGoals: awayGoals,
+			Played:        true,
+		})
+	}
+
+	return matches, nil
+}
+
+// dixonColesFit holds the fitted parameters of a Dixon-Coles model on the log scale
+type dixonColesFit struct {
+	attack         map[int]float64
+	defence        map[int]float64
+	base           float64
+	home           float64
+	rho            float64
+	logLikelihood  float64
+	freeParameters int
+	iterations     int
+	converged      bool
+}
+
+// rates returns the expected home and away goals for a match
+func (f *dixonColesFit) rates(homeTeamID, awayTeamID int) (lambda, mu float64) {
+	lambda = math.Exp(f.base + f.home + f.attack[homeTeamID] - f.defence[awayTeamID])
+	mu = math.Exp(f.base + f.attack[awayTeamID] - f.defence[homeTeamID])
+	return
+}
+
+// predictiveQuality returns the mean 1X2 Brier score and outcome accuracy of the fit
+func (f *dixonColesFit) predictiveQuality(matches []*models.Match) (brier, accuracy float64) {
+	correct := 0
+	for _, match := range matches {
+		lambda, mu := f.rates(match.HomeTeamID, match.AwayTeamID)
+		homeWin, draw, awayWin := outcomeProbabilities(dixonColesMatrix(lambda, mu, f.rho))
+
+		var actualHome, actualDraw, actualAway float64
+		switch {
+		case match.IsHomeWin():
+			actualHome = 1
+		case match.IsAwayWin():
+			actualAway = 1
+		default:
+			actualDraw = 1
+		}
+		brier += math.Pow(homeWin-actualHome, 2) + math.Pow(draw-actualDraw, 2) + math.Pow(awayWin-actualAway, 2)
+
+		if (homeWin >= draw && homeWin >= awayWin && actualHome == 1) ||
+			(awayWin > homeWin && awayWin >= draw && actualAway == 1) ||
+			(draw > homeWin && draw > awayWin && actualDraw == 1) {
+			correct++
+		}
+	}
+
+	n := float64(len(matches))
+	return brier / n, float64(correct) / n
+}
+
+// fitDixonColes fits the model by maximising the likelihood with gradient ascent.
+// Parameters are laid out as attack ratings, defence ratings, base rate, home advantage and rho.
+func fitDixonColes(matches []*models.Match, teamIDs []int) *dixonColesFit {
+	n := len(teamIDs)
+	index := make(map[int]int)
+	for i, id := range teamIDs {
+		index[id] = i
+	}
+	baseIdx, homeIdx, rhoIdx := 2*n, 2*n+1, 2*n+2
+
+	// Start from average teams and the observed scoring rates
+	homeGoals, awayGoals := 0.0, 0.0
+	for _, match := range matches {
+		homeGoals += float64(match.HomeTeamGoals)
+		awayGoals += float64(match.AwayTeamGoals)
+	}
+	params := make([]float64, 2*n+3)
+	params[baseIdx] = math.Log((awayGoals + 0.5) / float64(len(matches)))
+	params[homeIdx] = math.Log((homeGoals + 0.5) / (awayGoals + 0.5))
+
+	// objective returns the penalised log-likelihood and fills grad when it is not nil
+	objective := func(p []float64, grad []float64) float64 {
+		if grad != nil {
+			for i := range grad {
+				grad[i] = 0
+			}
+		}
+
+		logLik := 0.0
+		for _, match := range matches {
+			h, a := index[match.HomeTeamID], index[match.AwayTeamID]
+			x, y := match.HomeTeamGoals, match.AwayTeamGoals
+			lambda := math.Exp(p[baseIdx] + p[homeIdx] + p[h] - p[n+a])
+			mu := math.Exp(p[baseIdx] + p[a] - p[n+h])
+			rho := p[rhoIdx]
+
+			tau := dixonColesTau(x, y, lambda, mu, rho)
+			if tau <= 0 {
+				return math.Inf(-1)
+			}
+			logLik += math.Log(tau) + math.Log(poissonPMF(x, lambda)) + math.Log(poissonPMF(y, mu))
+
+			if grad == nil {
+				continue
+			}
+
+			// Derivatives with respect to log(lambda), log(mu) and rho
+			gLambda := float64(x) - lambda
+			gMu := float64(y) - mu
+			gRho := 0.0
+			switch {
+			case x == 0 && y == 0:
+				gLambda -= lambda * mu * rho / tau
+				gMu -= lambda * mu * rho / tau
+				gRho = -lambda * mu / tau
+			case x == 0 && y == 1:
+				gLambda += lambda * rho / tau
+				gRho = lambda / tau
+			case x == 1 && y == 0:
+				gMu += mu * rho / tau
+				gRho = mu / tau
+			case x == 1 && y == 1:
+				gRho = -1 / tau
+			}
+
+			grad[h] += gLambda
+			grad[n+a] -= gLambda
+			grad[a] += gMu
+			grad[n+h] -= gMu
+			grad[baseIdx] += gLambda + gMu
+			grad[homeIdx] += gLambda
+			grad[rhoIdx] += gRho
+		}
+
+		for i := 0; i < 2*n; i++ {
+			logLik -= calibrationRidge * p[i] * p[i]
+			if grad != nil {
+				grad[i] -= 2 * calibrationRidge * p[i]
+			}
+		}
+
+		return logLik
+	}
+
+	// center removes the offsets that leave the likelihood unchanged
+	center := func(p []float64) {
+		meanAttack, meanDefence := 0.0, 0.0
+		for i := 0; i < n; i++ {
+			meanAttack += p[i] / float64(n)
+			meanDefence += p[n+i] / float64(n)
+		}
+		for i := 0; i < n; i++ {
+			p[i] -= meanAttack
+			p[n+i] -= meanDefence
+		}
+		p[baseIdx] += meanAttack - meanDefence
+	}
+
+	fit := &dixonColesFit{
+		attack:         make(map[int]float64),
+		defence:        make(map[int]float64),
+		freeParameters: 2*(n-1) + 3,
+	}
+
+	grad := make([]float64, len(params))
+	candidate := make([]float64, len(params))
+	current := objective(params, grad)
+	step := 1.0 / float64(len(matches))
+
+	for fit.iterations < calibrationMaxIterations {
+		fit.iterations++
+
+		gradNorm := 0.0
+		for _, g := range grad {
+			gradNorm += g * g
+		}
+		if gradNorm < calibrationTolerance {
+			fit.converged = true
+			break
+		}
+
+		// Backtracking line search along the gradient
+		accepted := false
+		var next float64
+		for attempt := 0; attempt < 50; attempt++ {
+			for i := range params {
+				candidate[i] = params[i] + step*grad[i]
+			}
+			center(candidate)
+			next = objective(candidate, nil)
+			if next >= current+1e-4*step*gradNorm {
+				accepted = true
+				break
+			}
+			step /= 2
+		}
+		if !accepted {
+			// No step improves the fit although the gradient is not yet flat, so it stops short of the optimum
+			fit.converged = false
+			break
+		}
+
+		copy(params, candidate)
+		improvement := next - current
+		current = objective(params, grad)
+		step *= 1.5
+
+		if improvement < calibrationTolerance*(1+math.Abs(current)) {
+			fit.converged = true
+			break
+		}
+	}
+
+	for i, id := range teamIDs {
+		fit.attack[id] = params[i]
+		fit.defence[id] = params[n+i]
+	}
+	fit.base = params[baseIdx]
+	fit.home = params[homeIdx]
+	fit.rho = params[rhoIdx]
+
+	// Report the likelihood without the ridge penalty
+	for i := 0; i < 2*n; i++ {
+		current += calibrationRidge * params[i] * params[i]
+	}
+	fit.logLikelihood = current
+
+	return fit
+}
+
+// fittedStrengths rescales the fitted ratings to the 1-10 strength scale used by the simulator
+func fittedStrengths(fit *dixonColesFit) map[int]int {
+	maxRating := 0.0
+	for id := range fit.attack {
+		maxRating = math.Max(maxRating, math.Abs(fit.attack[id]+fit.defence[id]))
+	}
+
+	strengths := make(map[int]int)
+	for id := range fit.attack {
+		strength := 5
+		if maxRating > 0 {
+			strength = int(math.Round(5.5 + 4.5*(fit.attack[id]+fit.defence[id])/maxRating))
+		}
+		if strength < 1 {
+			strength = 1
+		}
+		if strength > 10 {
+			strength = 10
+		}
+		strengths[id] = strength
+	}
+
+	return strengths
+}
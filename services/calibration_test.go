@@ -0,0 +1,113 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/user/footballsim/models"
+)
+
+func TestFitDixonColesRecoversParameters(t *testing.T) {
+	tests := []struct {
+		name    string
+		attack  []float64
+		defence []float64
+		base    float64
+		home    float64
+		rounds  int
+	}{
+		{
+			name:    "spread league",
+			attack:  []float64{0.4, 0.2, 0, -0.1, -0.2, -0.3},
+			defence: []float64{0.3, 0.1, 0.1, -0.1, -0.1, -0.3},
+			base:    0.1,
+			home:    0.25,
+			rounds:  200,
+		},
+		{
+			name:    "attacking against defensive sides",
+			attack:  []float64{0.5, 0.3, -0.3, -0.5},
+			defence: []float64{-0.4, -0.2, 0.2, 0.4},
+			base:    0.3,
+			home:    0.1,
+			rounds:  300,
+		},
+		{
+			name:    "no home advantage",
+			attack:  []float64{0.2, 0, -0.2},
+			defence: []float64{0, 0.2, -0.2},
+			base:    0,
+			home:    0,
+			rounds:  500,
+		},
+	}
+
+	// Each team plays about 2000 matches, so a rating is within 0.1 of its true value by about four standard errors
+	const tolerance = 0.1
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			teamIDs := make([]int, len(tt.attack))
+			for i := range teamIDs {
+				teamIDs[i] = i + 1
+			}
+
+			// Every team plays every other team at home once per round
+			var matches []*models.Match
+			for round := 0; round < tt.rounds; round++ {
+				for h := range teamIDs {
+					for a := range teamIDs {
+						if h == a {
+							continue
+						}
+						lambda := math.Exp(tt.base + tt.home + tt.attack[h] - tt.defence[a])
+						mu := math.Exp(tt.base + tt.attack[a] - tt.defence[h])
+						matches = append(matches, &models.Match{
+							HomeTeamID:    teamIDs[h],
+							AwayTeamID:    teamIDs[a],
+							HomeTeamGoals: samplePoisson(rng, lambda),
+							AwayTeamGoals: samplePoisson(rng, mu),
+							Played:        true,
+						})
+					}
+				}
+			}
+
+			fit := fitDixonColes(matches, teamIDs)
+			if !fit.converged {
+				t.Fatalf("fit did not converge after %d iterations", fit.iterations)
+			}
+
+			for i, id := range teamIDs {
+				if diff := math.Abs(fit.attack[id] - tt.attack[i]); diff > tolerance {
+					t.Errorf("team %d attack = %.3f, want %.3f", id, fit.attack[id], tt.attack[i])
+				}
+				if diff := math.Abs(fit.defence[id] - tt.defence[i]); diff > tolerance {
+					t.Errorf("team %d defence = %.3f, want %.3f", id, fit.defence[id], tt.defence[i])
+				}
+			}
+			if diff := math.Abs(fit.base - tt.base); diff > tolerance {
+				t.Errorf("base = %.3f, want %.3f", fit.base, tt.base)
+			}
+			if diff := math.Abs(fit.home - tt.home); diff > tolerance {
+				t.Errorf("home advantage = %.3f, want %.3f", fit.home, tt.home)
+			}
+			// The goals are independent, so there is no low-score dependence to find
+			if math.Abs(fit.rho) > 0.15 {
+				t.Errorf("rho = %.3f, want about 0", fit.rho)
+			}
+		})
+	}
+}
+
+// samplePoisson draws a Poisson distributed goal count with Knuth's method
+func samplePoisson(rng *rand.Rand, mean float64) int {
+	limit := math.Exp(-mean)
+	goals := 0
+	for p := rng.Float64(); p > limit; p *= rng.Float64() {
+		goals++
+	}
+	return goals
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/footballsim/models"
+)
+
+// ErrInvalidExperiment is returned when an experiment cannot be run
+var ErrInvalidExperiment = errors.New("invalid experiment")
+
+const (
+	defaultExperimentSeasons = 1000
+	maxExperimentSeasons     = 100000
+	maxExperimentWorkers     = 32
+)
+
+// ExperimentRunner simulates many complete seasons from week 1 on in-memory copies of the league
+type ExperimentRunner struct {
+	TeamRepo  TeamRepository
+	MatchRepo MatchRepository
+	// Simulator plays the matches; it is called from several goroutines at once
+	Simulator Simulator
+}
+
+// NewExperimentRunner creates a new experiment runner
+func NewExperimentRunner(teamRepo TeamRepository, matchRepo MatchRepository, simulator Simulator) *ExperimentRunner {
+	return &ExperimentRunner{
+		TeamRepo:  teamRepo,
+		MatchRepo: matchRepo,
+		Simulator: simulator,
+	}
+}
+
+// Run plays config.Seasons complete seasons of the league's fixtures, ignoring any results
+// already played, spread over config.Workers goroutines, and aggregates them into a report.
+// It stops with ctx's error when ctx ends first. Finished seasons are reported to the ProgressFunc of ctx.
+func (r *ExperimentRunner) Run(ctx context.Context, config *models.ExperimentConfig) (*models.ExperimentReport, error) {
+	simulator, homeAdvantage, err := r.configure(config)
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := r.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(teams) < 2 {
+		return nil, fmt.Errorf("%w: the league needs at least two teams", ErrInvalidExperiment)
+	}
+
+	fixtures, err := r.MatchRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("%w: the league has no fixtures", ErrInvalidExperiment)
+	}
+
+	// Every season starts from zeroed standings
+	freshTeams := make([]*models.Team, len(teams))
+	for i, team := range teams {
+		freshTeams[i] = &models.Team{
+			ID:       team.ID,
+			Name:     team.Name,
+			Strength: team.Strength,
+			Attack:   team.Attack,
+			Defence:  team.Defence,
+		}
+	}
+
+	started := time.Now()
+	seed := started.UnixNano()
+
+	// Each worker aggregates its own seasons; the results are merged at the end
+	var finished int64
+	results := make([]*experimentTally, config.Workers)
+	errs := make([]error, config.Workers)
+	var wg sync.WaitGroup
+	for worker := 0; worker < config.Workers; worker++ {
+		seasons := config.Seasons / config.Workers
+		if worker < config.Seasons%config.Workers {
+			seasons++
+		}
+
+		wg.Add(1)
+		go func(worker, seasons int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(worker)))
+			tally := newExperimentTally(freshTeams)
+			for season := 0; season < seasons; season++ {
+				if err := ctx.Err(); err != nil {
+					errs[worker] = err
+					return
+				}
+				if err := tally.playSeason(simulator, rng, freshTeams, fixtures); err != nil {
+					errs[worker] = err
+					return
+				}
+				reportProgress(ctx, int(atomic.AddInt64(&finished, 1)), config.Seasons)
+			}
+			results[worker] = tally
+		}(worker, seasons)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	total := newExperimentTally(freshTeams)
+	for _, tally := range results {
+		total.merge(tally)
+	}
+
+	report := total.report()
+	report.Workers = config.Workers
+	report.HomeAdvantage = homeAdvantage
+	report.DurationMillis = time.Since(started).Milliseconds()
+	return report, nil
+}
+
+// configure fills in the defaults of an experiment and returns the simulator to use
+func (r *ExperimentRunner) configure(config *models.ExperimentConfig) (Simulator, float64, error) {
+	if config.Seasons == 0 {
+		config.Seasons = defaultExperimentSeasons
+	}
+	if config.Seasons < 1 || config.Seasons > maxExperimentSeasons {
+		return nil, 0, fmt.Errorf("%w: seasons must be between 1 and %d", ErrInvalidExperiment, maxExperimentSeasons)
+	}
+
+	if config.Workers == 0 {
+		config.Workers = runtime.NumCPU()
+	}
+	if config.Workers < 1 || config.Workers > maxExperimentWorkers {
+		return nil, 0, fmt.Errorf("%w: workers must be between 1 and %d", ErrInvalidExperiment, maxExperimentWorkers)
+	}
+	if config.Workers > config.Seasons {
+		config.Workers = config.Seasons
+	}
+
+	matchSimulator, isMatchSimulator := r.Simulator.(*MatchSimulator)
+	if config.HomeAdvantage == nil {
+		if isMatchSimulator {
+			return r.Simulator, matchSimulator.HomeAdvantage, nil
+		}
+		return r.Simulator, 0, nil
+	}
+
+	// Changing the home advantage needs a simulator that has one
+	if !isMatchSimulator {
+		return nil, 0, fmt.Errorf("%w: the simulator has no home advantage setting", ErrInvalidExperiment)
+	}
+	if *config.HomeAdvantage < 0 || *config.HomeAdvantage > 1 {
+		return nil, 0, fmt.Errorf("%w: home_advantage must be between 0 and 1", ErrInvalidExperiment)
+	}
+	simulatorCopy := *matchSimulator
+	simulatorCopy.HomeAdvantage = *config.HomeAdvantage
+	return &simulatorCopy, simulatorCopy.HomeAdvantage, nil
+}
+
+// experimentTally accumulates the simulated seasons of one worker
+type experimentTally struct {
+	distribution    *tableDistribution
+	strongest       map[int]bool
+	strongestTitles int
+	titleMarginSum  float64
+	pointsSpreadSum float64
+	homeWins        int
+	draws           int
+	awayWins        int
+	goals           int
+	matches         int
+}
+
+// newExperimentTally creates an empty tally for the given teams
+func newExperimentTally(teams []*models.Team) *experimentTally {
+	maxStrength := 0
+	for _, team := range teams {
+		if team.Strength > maxStrength {
+			maxStrength = team.Strength
+		}
+	}
+
+	strongest := make(map[int]bool)
+	for _, team := range teams {
+		if team.Strength == maxStrength {
+			strongest[team.ID] = true
+		}
+	}
+
+	return &experimentTally{
+		distribution: newTableDistribution(teams),
+		strongest:    strongest,
+	}
+}
+
+// playSeason simulates every fixture on copies of the teams and records the final table
+func (t *experimentTally) playSeason(simulator Simulator, rng *rand.Rand, teams []*models.Team, fixtures []*models.Match) error {
+	teamMap := make(map[int]*models.Team, len(teams))
+	teamCopies := make([]*models.Team, len(teams))
+	for i, team := range teams {
+		teamCopy := *team
+		teamCopies[i] = &teamCopy
+		teamMap[team.ID] = &teamCopy
+	}
+
+	for _, fixture := range fixtures {
+		homeTeam := teamMap[fixture.HomeTeamID]
+		awayTeam := teamMap[fixture.AwayTeamID]
+
+		match, err := simulateMatchWithRand(simulator, homeTeam, awayTeam, rng)
+		if err != nil {
+			return err
+		}
+		updateTeamStats(homeTeam, awayTeam, match)
+
+		t.matches++
+		t.goals += match.HomeTeamGoals + match.AwayTeamGoals
+		switch {
+		case match.HomeTeamGoals > match.AwayTeamGoals:
+			t.homeWins++
+		case match.HomeTeamGoals < match.AwayTeamGoals:
+			t.awayWins++
+		default:
+			t.draws++
+		}
+	}
+
+	table := teamStatsFromTeams(teamCopies)
+	sortTeamStats(table)
+	t.distribution.Add(table)
+
+	if t.strongest[table[0].TeamID] {
+		t.strongestTitles++
+	}
+	t.titleMarginSum += float64(table[0].Points - table[1].Points)
+
+	mean := 0.0
+	for _, stats := range table {
+		mean += float64(stats.Points)
+	}
+	mean /= float64(len(table))
+	variance := 0.0
+	for _, stats := range table {
+		variance += (float64(stats.Points) - mean) * (float64(stats.Points) - mean)
+	}
+	t.pointsSpreadSum += math.Sqrt(variance / float64(len(table)))
+
+	return nil
+}
+
+// merge adds the seasons of another tally
+func (t *experimentTally) merge(other *experimentTally) {
+	t.distribution.Merge(other.distribution)
+	t.strongestTitles += other.strongestTitles
+	t.titleMarginSum += other.titleMarginSum
+	t.pointsSpreadSum += other.pointsSpreadSum
+	t.homeWins += other.homeWins
+	t.draws += other.draws
+	t.awayWins += other.awayWins
+	t.goals += other.goals
+	t.matches += other.matches
+}
+
+// report turns the tally into an experiment report
+func (t *experimentTally) report() *models.ExperimentReport {
+	distribution := t.distribution.Result()
+	report := &models.ExperimentReport{
+		Seasons: distribution.Runs,
+		Teams:   distribution.Teams,
+	}
+	if distribution.Runs == 0 || t.matches == 0 {
+		return report
+	}
+
+	seasons := float64(distribution.Runs)
+	matches := float64(t.matches)
+	report.StrongestTeamTitleRate = float64(t.strongestTitles) / seasons
+	report.AverageTitleMargin = t.titleMarginSum / seasons
+	report.AveragePointsSpread = t.pointsSpreadSum / seasons
+	report.HomeWinRate = float64(t.homeWins) / matches
+	report.DrawRate = float64(t.draws) / matches
+	report.AwayWinRate = float64(t.awayWins) / matches
+	report.AverageGoalsPerMatch = float64(t.goals) / matches
+	return report
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/user/footballsim/models"
+)
+
+// ErrPredictionsUnavailable is returned when the league's prediction rule does not allow a prediction yet
+var ErrPredictionsUnavailable = errors.New("predictions unavailable")
+
+// Exporter reads league data for export in CSV, Excel-friendly CSV or JSON
+type Exporter struct {
+	TeamRepo   TeamRepository
+	MatchRepo  MatchRepository
+	LeagueRepo LeagueRepository
+	Predictor  Predictor
+}
+
+// NewExporter creates a new exporter
+func NewExporter(teamRepo TeamRepository, matchRepo MatchRepository, leagueRepo LeagueRepository, predictor Predictor) *Exporter {
+	return &Exporter{
+		TeamRepo:   teamRepo,
+		MatchRepo:  matchRepo,
+		LeagueRepo: leagueRepo,
+		Predictor:  predictor,
+	}
+}
+
+// Table returns the current league table
+func (e *Exporter) Table(ctx context.Context) ([]*models.TeamStats, error) {
+	teams, err := e.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	table := teamStatsFromTeams(teams)
+	sortTeamStats(table)
+	return table, nil
+}
+
+// Matches returns all matches, played or not
+func (e *Exporter) Matches(ctx context.Context) ([]*models.Match, error) {
+	return e.MatchRepo.GetAll(ctx)
+}
+
+// Prediction returns the predicted final table once the league's prediction rule allows it
+func (e *Exporter) Prediction(ctx context.Context) ([]*models.TeamStats, error) {
+	league, err := e.LeagueRepo.GetCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !league.PredictionsAvailable() {
+		return nil, fmt.Errorf("%w: %s", ErrPredictionsUnavailable, league.PredictionUnavailableReason())
+	}
+
+	table, err := e.Predictor.PredictFinalTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sortTeamStats(table)
+	return table, nil
+}
+
+// Snapshot returns a complete copy of the league that Importer.ImportSnapshot can restore
+func (e *Exporter) Snapshot(ctx context.Context) (*models.LeagueSnapshot, error) {
+	league, err := e.LeagueRepo.GetCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := e.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := e.MatchRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.LeagueSnapshot{
+		Version:    models.SnapshotVersion,
+		ExportedAt: time.Now().UTC(),
+		League:     league,
+		Teams:      teams,
+		Matches:    make([]*models.SnapshotMatch, len(matches)),
+	}
+	for i, match := range matches {
+		snapshot.Matches[i] = &models.SnapshotMatch{
+			Week:          match.Week,
+			HomeTeam:      match.HomeTeamName,
+			AwayTeam:      match.AwayTeamName,
+			HomeTeamGoals: match.HomeTeamGoals,
+			AwayTeamGoals: match.AwayTeamGoals,
+			Played:        match.Played,
+			IsEdited:      match.IsEdited,
+		}
+		if !match.PlayedAt.IsZero() {
+			playedAt := match.PlayedAt
+			snapshot.Matches[i].PlayedAt = &playedAt
+		}
+	}
+
+	return snapshot, nil
+}
+
+// tableColumns is the CSV header of table and prediction exports
+var tableColumns = []string{"position", "team", "played", "won", "drawn", "lost", "goals_for", "goals_against", "goal_difference", "points"}
+
+// WriteTable writes a league table in the given format
+func WriteTable(w io.Writer, format string, table []*models.TeamStats) error {
+	rows := make([][]string, len(table))
+	for i, stats := range table {
+		rows[i] = []string{
+			strconv.Itoa(i + 1),
+			stats.TeamName,
+			strconv.Itoa(stats.Played),
+			strconv.Itoa(stats.Won),
+			strconv.Itoa(stats.Drawn),
+			strconv.Itoa(stats.Lost),
+			strconv.Itoa(stats.GoalsFor),
+			strconv.Itoa(stats.GoalsAgainst),
+			strconv.Itoa(stats.GoalDifference),
+			strconv.Itoa(stats.Points),
+		}
+	}
+	return writeExport(w, format, table, tableColumns, rows)
+}
+
+// WriteMatches writes matches in the given format. The CSV columns match the fixture import,
+// with empty scores for unplayed matches, so an export can be imported again.
+func WriteMatches(w io.Writer, format string, matches []*models.Match) error {
+	rows := make([][]string, len(matches))
+	for i, match := range matches {
+		row := []string{strconv.Itoa(match.Week), match.HomeTeamName, match.AwayTeamName, "", "", ""}
+		if match.Played {
+			row[3] = strconv.Itoa(match.HomeTeamGoals)
+			row[4] = strconv.Itoa(match.AwayTeamGoals)
+		}
+		if !match.PlayedAt.IsZero() {
+			row[5] = match.PlayedAt.UTC().Format(time.RFC3339)
+		}
+		rows[i] = row
+	}
+	return writeExport(w, format, matches, []string{"week", "home_team", "away_team", "home_goals", "away_goals", "played_at"}, rows)
+}
+
+// CheckExportFormat returns ErrUnsupportedFormat for formats the Write functions cannot produce
+func CheckExportFormat(format string) error {
+	switch format {
+	case models.FormatJSON, models.FormatCSV, models.FormatExcel:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+}
+
+// writeExport writes value as JSON, or the header and rows as CSV
+func writeExport(w io.Writer, format string, value interface{}, header []string, rows [][]string) error {
+	if err := CheckExportFormat(format); err != nil {
+		return err
+	}
+
+	if format == models.FormatJSON {
+		return json.NewEncoder(w).Encode(value)
+	}
+
+	writer := csv.NewWriter(w)
+	if format == models.FormatExcel {
+		// Without the byte order mark Excel reads UTF-8 team names as ANSI
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return err
+		}
+		writer.UseCRLF = true
+	}
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
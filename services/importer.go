@@ -0,0 +1,638 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/user/footballsim/models"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for import or export formats that are not supported
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrInvalidImportFile is returned when an import file cannot be read at all
+	ErrInvalidImportFile = errors.New("invalid import file")
+)
+
+// Importer validates team and fixture files and inserts them through the repositories
+type Importer struct {
+	TeamRepo   TeamRepository
+	MatchRepo  MatchRepository
+	LeagueRepo LeagueRepository
+	Tx         Transactor
+	Lock       LeagueLock
+}
+
+// NewImporter creates a new importer
+func NewImporter(teamRepo TeamRepository, matchRepo MatchRepository, leagueRepo LeagueRepository, tx Transactor, lock LeagueLock) *Importer {
+	return &Importer{
+		TeamRepo:   teamRepo,
+		MatchRepo:  matchRepo,
+		LeagueRepo: leagueRepo,
+		Tx:         tx,
+		Lock:       lock,
+	}
+}
+
+// ImportTeams reads teams (name, strength) from CSV or JSON and creates them.
+// All rows are validated first; nothing is created if any row is invalid or on a dry run.
+func (i *Importer) ImportTeams(ctx context.Context, format string, r io.Reader, dryRun bool) (*models.ImportReport, error) {
+	report := newImportReport(models.ImportKindTeams, format, dryRun)
+
+	// The rows are checked against the current teams, which must not change before they are created
+	if !dryRun {
+		unlock, err := i.Lock.Lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	rows, lines, err := readTeamRows(format, r, report)
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := i.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, team := range teams {
+		names[strings.ToLower(team.Name)] = true
+	}
+
+	for n, row := range rows {
+		line := lines[n]
+		row.Name = strings.TrimSpace(row.Name)
+		switch {
+		case row.Name == "":
+			addImportError(report, line, "team name is required")
+		case models.NameTooLong(row.Name):
+			addImportError(report, line, fmt.Sprintf("team name must be at most %d characters long", models.MaxNameLength))
+		case names[strings.ToLower(row.Name)]:
+			addImportError(report, line, fmt.Sprintf("team %q already exists", row.Name))
+		}
+		if row.Strength < models.MinTeamStrength || row.Strength > models.MaxTeamStrength {
+			addImportError(report, line, fmt.Sprintf("strength must be between %d and %d", models.MinTeamStrength, models.MaxTeamStrength))
+		}
+		names[strings.ToLower(row.Name)] = true
+	}
+
+	sortImportErrors(report)
+	if dryRun || len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	// The teams are created in one transaction, so a failed row leaves none of them behind
+	err = i.Tx.InTx(ctx, func(ctx context.Context) error {
+		for _, row := range rows {
+			team := &models.Team{
+				Name:     row.Name,
+				Strength: row.Strength,
+			}
+			if err := i.TeamRepo.Create(ctx, team); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Imported = len(rows)
+
+	return report, nil
+}
+
+// ImportFixtures reads fixtures (week, home team, away team, optional score) from CSV or JSON and creates them.
+// Team names must match existing teams, weeks must fall within the league, and no team may play twice in a week.
+// Fixtures with a score are stored as played and update the team standings.
+func (i *Importer) ImportFixtures(ctx context.Context, format string, r io.Reader, dryRun bool) (*models.ImportReport, error) {
+	report := newImportReport(models.ImportKindFixtures, format, dryRun)
+
+	// The rows are checked against the current teams and matches, which must not change before they are created
+	if !dryRun {
+		unlock, err := i.Lock.Lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	rows, lines, err := readFixtureRows(format, r, report)
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := i.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	teamsByName := make(map[string]*models.Team)
+	for _, team := range teams {
+		teamsByName[strings.ToLower(team.Name)] = team
+	}
+
+	totalWeeks, err := i.LeagueRepo.GetTotalWeeks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := i.MatchRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Track which teams already play in each week
+	busy := make(map[int]map[int]bool)
+	markBusy := func(week, teamID int) bool {
+		if busy[week] == nil {
+			busy[week] = make(map[int]bool)
+		}
+		if busy[week][teamID] {
+			return false
+		}
+		busy[week][teamID] = true
+		return true
+	}
+	for _, match := range existing {
+		markBusy(match.Week, match.HomeTeamID)
+		markBusy(match.Week, match.AwayTeamID)
+	}
+
+	matches := make([]*models.Match, 0, len(rows))
+	for n, row := range rows {
+		line := lines[n]
+		errorsBefore := len(report.Errors)
+
+		homeTeam, homeOK := teamsByName[strings.ToLower(strings.TrimSpace(row.HomeTeam))]
+		if !homeOK {
+			addImportError(report, line, fmt.Sprintf("unknown home team %q", row.HomeTeam))
+		}
+		awayTeam, awayOK := teamsByName[strings.ToLower(strings.TrimSpace(row.AwayTeam))]
+		if !awayOK {
+			addImportError(report, line, fmt.Sprintf("unknown away team %q", row.AwayTeam))
+		}
+		if row.Week < 1 || row.Week > totalWeeks {
+			addImportError(report, line, fmt.Sprintf("week must be between 1 and %d", totalWeeks))
+		}
+		if (row.HomeGoals == nil) != (row.AwayGoals == nil) {
+			addImportError(report, line, "a score needs both home_goals and away_goals")
+		}
+		if (row.HomeGoals != nil && *row.HomeGoals < 0) || (row.AwayGoals != nil && *row.AwayGoals < 0) {
+			addImportError(report, line, "goals cannot be negative")
+		}
+
+		if homeOK && awayOK {
+			if homeTeam.ID == awayTeam.ID {
+				addImportError(report, line, "a team cannot play itself")
+			} else {
+				if !markBusy(row.Week, homeTeam.ID) {
+					addImportError(report, line, fmt.Sprintf("%s already plays in week %d", homeTeam.Name, row.Week))
+				}
+				if !markBusy(row.Week, awayTeam.ID) {
+					addImportError(report, line, fmt.Sprintf("%s already plays in week %d", awayTeam.Name, row.Week))
+				}
+			}
+		}
+
+		if len(report.Errors) > errorsBefore {
+			continue
+		}
+
+		match := &models.Match{
+			Week:         row.Week,
+			HomeTeamID:   homeTeam.ID,
+			AwayTeamID:   awayTeam.ID,
+			HomeTeamName: homeTeam.Name,
+			AwayTeamName: awayTeam.Name,
+		}
+		if row.HomeGoals != nil && row.AwayGoals != nil {
+			match.HomeTeamGoals = *row.HomeGoals
+			match.AwayTeamGoals = *row.AwayGoals
+			match.Played = true
+			match.PlayedAt = time.Now()
+		}
+		matches = append(matches, match)
+	}
+
+	sortImportErrors(report)
+	if dryRun || len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	// The fixtures and standings are saved in one transaction, so a failed row leaves none of them behind
+	err = i.Tx.InTx(ctx, func(ctx context.Context) error {
+		changed := make(map[int]*models.Team)
+		for _, match := range matches {
+			if err := i.MatchRepo.Create(ctx, match); err != nil {
+				return err
+			}
+			if match.Played {
+				homeTeam := teamsByName[strings.ToLower(match.HomeTeamName)]
+				awayTeam := teamsByName[strings.ToLower(match.AwayTeamName)]
+				updateTeamStats(homeTeam, awayTeam, match)
+				changed[homeTeam.ID] = homeTeam
+				changed[awayTeam.ID] = awayTeam
+			}
+		}
+
+		// Save the standings of teams that gained imported results; the others keep their version
+		for _, team := range teams {
+			if changed[team.ID] == nil {
+				continue
+			}
+			if err := i.TeamRepo.Update(ctx, team); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Imported = len(matches)
+
+	return report, nil
+}
+
+// ImportSnapshot replaces the league, teams and matches with a snapshot written by Exporter.Snapshot.
+// The snapshot is checked as a whole first; an invalid snapshot changes nothing, and a valid one
+// is written in a single transaction under the league lock.
+func (i *Importer) ImportSnapshot(ctx context.Context, r io.Reader, dryRun bool) (*models.ImportReport, error) {
+	report := newImportReport(models.ImportKindSnapshot, models.FormatJSON, dryRun)
+
+	snapshot := new(models.LeagueSnapshot)
+	if err := json.NewDecoder(r).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+	if err := validateSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+
+	report.Rows = len(snapshot.Teams) + len(snapshot.Matches)
+	if dryRun {
+		return report, nil
+	}
+
+	// Nothing else may change the league while it is replaced, and the replacement is all or nothing
+	unlock, err := i.Lock.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	err = i.Tx.InTx(ctx, func(ctx context.Context) error {
+		return i.replaceLeague(ctx, snapshot, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// replaceLeague deletes the current league, teams and matches and creates the snapshot's
+func (i *Importer) replaceLeague(ctx context.Context, snapshot *models.LeagueSnapshot, report *models.ImportReport) error {
+	// Matches go first because they reference the teams
+	matches, err := i.MatchRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		if err := i.MatchRepo.Delete(ctx, match.ID); err != nil {
+			return err
+		}
+	}
+
+	teams, err := i.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, team := range teams {
+		if err := i.TeamRepo.Delete(ctx, team.ID); err != nil {
+			return err
+		}
+	}
+
+	teamsByName := make(map[string]*models.Team)
+	for _, team := range snapshot.Teams {
+		if err := i.TeamRepo.Create(ctx, team); err != nil {
+			return err
+		}
+		teamsByName[strings.ToLower(team.Name)] = team
+		report.Imported++
+	}
+
+	for _, snapshotMatch := range snapshot.Matches {
+		homeTeam := teamsByName[strings.ToLower(snapshotMatch.HomeTeam)]
+		awayTeam := teamsByName[strings.ToLower(snapshotMatch.AwayTeam)]
+		match := &models.Match{
+			Week:          snapshotMatch.Week,
+			HomeTeamID:    homeTeam.ID,
+			AwayTeamID:    awayTeam.ID,
+			HomeTeamName:  homeTeam.Name,
+			AwayTeamName:  awayTeam.Name,
+			HomeTeamGoals: snapshotMatch.HomeTeamGoals,
+			AwayTeamGoals: snapshotMatch.AwayTeamGoals,
+			Played:        snapshotMatch.Played,
+			IsEdited:      snapshotMatch.IsEdited,
+		}
+		if snapshotMatch.PlayedAt != nil {
+			match.PlayedAt = *snapshotMatch.PlayedAt
+		}
+		if err := i.MatchRepo.Create(ctx, match); err != nil {
+			return err
+		}
+		report.Imported++
+	}
+
+	league := snapshot.League
+	current, err := i.LeagueRepo.GetCurrent(ctx)
+	switch {
+	case err == nil:
+		league.ID, league.Version = current.ID, current.Version
+		return i.LeagueRepo.Update(ctx, league)
+	case errors.Is(err, sql.ErrNoRows):
+		return i.LeagueRepo.Create(ctx, league)
+	}
+	return err
+}
+
+// validateSnapshot checks that a snapshot is complete and consistent before anything is replaced
+func validateSnapshot(snapshot *models.LeagueSnapshot) error {
+	if snapshot.Version != models.SnapshotVersion {
+		return fmt.Errorf("%w: unsupported snapshot version %d", ErrInvalidImportFile, snapshot.Version)
+	}
+	if snapshot.League == nil {
+		return fmt.Errorf("%w: snapshot has no league", ErrInvalidImportFile)
+	}
+	if models.NameTooLong(snapshot.League.Name) {
+		return fmt.Errorf("%w: league name must be at most %d characters long", ErrInvalidImportFile, models.MaxNameLength)
+	}
+	if utf8.RuneCountInString(snapshot.League.Season) > models.MaxSeasonLength {
+		return fmt.Errorf("%w: league season must be at most %d characters long", ErrInvalidImportFile, models.MaxSeasonLength)
+	}
+	if snapshot.League.TotalWeeks < 1 || snapshot.League.CurrentWeek < 1 {
+		return fmt.Errorf("%w: league weeks must be positive", ErrInvalidImportFile)
+	}
+	if err := snapshot.League.ValidatePredictionRule(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+
+	names := make(map[string]bool)
+	for n, team := range snapshot.Teams {
+		if team == nil {
+			return fmt.Errorf("%w: team %d is empty", ErrInvalidImportFile, n+1)
+		}
+		team.Name = strings.TrimSpace(team.Name)
+		switch {
+		case team.Name == "":
+			return fmt.Errorf("%w: team %d has no name", ErrInvalidImportFile, n+1)
+		case models.NameTooLong(team.Name):
+			return fmt.Errorf("%w: team %d name must be at most %d characters long", ErrInvalidImportFile, n+1, models.MaxNameLength)
+		case names[strings.ToLower(team.Name)]:
+			return fmt.Errorf("%w: duplicate team %q", ErrInvalidImportFile, team.Name)
+		case team.Strength < models.MinTeamStrength || team.Strength > models.MaxTeamStrength:
+			return fmt.Errorf("%w: team %q strength must be between %d and %d", ErrInvalidImportFile, team.Name, models.MinTeamStrength, models.MaxTeamStrength)
+		}
+		names[strings.ToLower(team.Name)] = true
+	}
+
+	for n, match := range snapshot.Matches {
+		if match == nil {
+			return fmt.Errorf("%w: match %d is empty", ErrInvalidImportFile, n+1)
+		}
+		switch {
+		case strings.EqualFold(strings.TrimSpace(match.HomeTeam), strings.TrimSpace(match.AwayTeam)):
+			return fmt.Errorf("%w: match %d has the same home and away team %q", ErrInvalidImportFile, n+1, match.HomeTeam)
+		case !names[strings.ToLower(strings.TrimSpace(match.HomeTeam))]:
+			return fmt.Errorf("%w: match %d has unknown home team %q", ErrInvalidImportFile, n+1, match.HomeTeam)
+		case !names[strings.ToLower(strings.TrimSpace(match.AwayTeam))]:
+			return fmt.Errorf("%w: match %d has unknown away team %q", ErrInvalidImportFile, n+1, match.AwayTeam)
+		case match.Week < 1 || match.Week > snapshot.League.TotalWeeks:
+			return fmt.Errorf("%w: match %d week must be between 1 and %d", ErrInvalidImportFile, n+1, snapshot.League.TotalWeeks)
+		case match.HomeTeamGoals < 0 || match.AwayTeamGoals < 0:
+			return fmt.Errorf("%w: match %d goals cannot be negative", ErrInvalidImportFile, n+1)
+		}
+		match.HomeTeam = strings.TrimSpace(match.HomeTeam)
+		match.AwayTeam = strings.TrimSpace(match.AwayTeam)
+	}
+
+	return nil
+}
+
+// newImportReport creates an empty import report
+func newImportReport(kind, format string, dryRun bool) *models.ImportReport {
+	return &models.ImportReport{
+		Kind:   kind,
+		Format: format,
+		DryRun: dryRun,
+		Errors: make([]*models.ImportError, 0),
+	}
+}
+
+// addImportError records a problem with a line of the import file
+func addImportError(report *models.ImportReport, line int, message string) {
+	report.Errors = append(report.Errors, &models.ImportError{Line: line, Message: message})
+}
+
+// sortImportErrors orders the errors of a report by line
+func sortImportErrors(report *models.ImportReport) {
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+}
+
+// readTeamRows parses team rows and returns them with their line numbers
+func readTeamRows(format string, r io.Reader, report *models.ImportReport) ([]*models.TeamImportRow, []int, error) {
+	switch format {
+	case models.FormatJSON:
+		items := make([]*models.TeamImportRow, 0)
+		if err := json.NewDecoder(r).Decode(&items); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		report.Rows = len(items)
+		rows, rowLines := nonNilTeamRows(items, report)
+		return rows, rowLines, nil
+
+	case models.FormatCSV:
+		records, lines, err := readCSVRecords(r, []string{"name", "strength"})
+		if err != nil {
+			return nil, nil, err
+		}
+		report.Rows = len(records)
+
+		rows := make([]*models.TeamImportRow, 0, len(records))
+		rowLines := make([]int, 0, len(records))
+		for n, record := range records {
+			strength, err := strconv.Atoi(record["strength"])
+			if err != nil {
+				addImportError(report, lines[n], fmt.Sprintf("invalid strength %q", record["strength"]))
+				continue
+			}
+			rows = append(rows, &models.TeamImportRow{Name: record["name"], Strength: strength})
+			rowLines = append(rowLines, lines[n])
+		}
+		return rows, rowLines, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+}
+
+// readFixtureRows parses fixture rows and returns them with their line numbers
+func readFixtureRows(format string, r io.Reader, report *models.ImportReport) ([]*models.FixtureImportRow, []int, error) {
+	switch format {
+	case models.FormatJSON:
+		items := make([]*models.FixtureImportRow, 0)
+		if err := json.NewDecoder(r).Decode(&items); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		report.Rows = len(items)
+		rows, rowLines := nonNilFixtureRows(items, report)
+		return rows, rowLines, nil
+
+	case models.FormatCSV:
+		records, lines, err := readCSVRecords(r, []string{"week", "home_team", "away_team"})
+		if err != nil {
+			return nil, nil, err
+		}
+		report.Rows = len(records)
+
+		rows := make([]*models.FixtureImportRow, 0, len(records))
+		rowLines := make([]int, 0, len(records))
+		for n, record := range records {
+			row := &models.FixtureImportRow{
+				HomeTeam: record["home_team"],
+				AwayTeam: record["away_team"],
+			}
+
+			week, err := strconv.Atoi(record["week"])
+			if err != nil {
+				addImportError(report, lines[n], fmt.Sprintf("invalid week %q", record["week"]))
+				continue
+			}
+			row.Week = week
+
+			valid := true
+			for _, goals := range []struct {
+				column string
+				target **int
+			}{{"home_goals", &row.HomeGoals}, {"away_goals", &row.AwayGoals}} {
+				if record[goals.column] == "" {
+					continue
+				}
+				value, err := strconv.Atoi(record[goals.column])
+				if err != nil {
+					addImportError(report, lines[n], fmt.Sprintf("invalid %s %q", goals.column, record[goals.column]))
+					valid = false
+					continue
+				}
+				*goals.target = &value
+			}
+			if !valid {
+				continue
+			}
+
+			rows = append(rows, row)
+			rowLines = append(rowLines, lines[n])
+		}
+		return rows, rowLines, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+}
+
+// readCSVRecords reads a CSV file with a header row into maps keyed by lower case column name
+func readCSVRecords(r io.Reader, required []string) ([]map[string]string, []int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: missing header row", ErrInvalidImportFile)
+	}
+
+	// Spreadsheet exports may start with a UTF-8 byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	columns := make([]string, len(header))
+	present := make(map[string]bool)
+	for i, name := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(name))
+		present[columns[i]] = true
+	}
+	for _, column := range required {
+		if !present[column] {
+			return nil, nil, fmt.Errorf("%w: missing %q column", ErrInvalidImportFile, column)
+		}
+	}
+
+	records := make([]map[string]string, 0)
+	lines := make([]int, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		values := make(map[string]string)
+		for i, value := range record {
+			if i < len(columns) {
+				values[columns[i]] = strings.TrimSpace(value)
+			}
+		}
+		records = append(records, values)
+		lines = append(lines, line)
+	}
+
+	return records, lines, nil
+}
+
+// nonNilTeamRows drops null JSON team rows, reporting each as an error, and numbers the rest from 1
+func nonNilTeamRows(items []*models.TeamImportRow, report *models.ImportReport) ([]*models.TeamImportRow, []int) {
+	rows := make([]*models.TeamImportRow, 0, len(items))
+	lines := make([]int, 0, len(items))
+	for n, row := range items {
+		if row == nil {
+			addImportError(report, n+1, "row is empty")
+			continue
+		}
+		rows = append(rows, row)
+		lines = append(lines, n+1)
+	}
+	return rows, lines
+}
+
+// nonNilFixtureRows drops null JSON fixture rows, reporting each as an error, and numbers the rest from 1
+func nonNilFixtureRows(items []*models.FixtureImportRow, report *models.ImportReport) ([]*models.FixtureImportRow, []int) {
+	rows := make([]*models.FixtureImportRow, 0, len(items))
+	lines := make([]int, 0, len(items))
+	for n, row := range items {
+		if row == nil {
+			addImportError(report, n+1, "row is empty")
+			continue
+		}
+		rows = append(rows, row)
+		lines = append(lines, n+1)
+	}
+	return rows, lines
+}
@@ -1,46 +1,130 @@
 package services
 
-import "github.com/user/footballsim/models"
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/user/footballsim/models"
+)
 
 // TeamRepository defines the methods that any team repository must implement
 type TeamRepository interface {
-	GetAll() ([]*models.Team, error)
-	GetByID(id int) (*models.Team, error)
-	Create(team *models.Team) error
-	Update(team *models.Team) error
-	Delete(id int) error
+	GetAll(ctx context.Context) ([]*models.Team, error)
+	GetByID(ctx context.Context, id int) (*models.Team, error)
+	Create(ctx context.Context, team *models.Team) error
+	Update(ctx context.Context, team *models.Team) error
+	Delete(ctx context.Context, id int) error
 }
 
 // MatchRepository defines the methods that any match repository must implement
 type MatchRepository interface {
-	GetAll() ([]*models.Match, error)
-	GetByID(id int) (*models.Match, error)
-	GetByWeek(week int) ([]*models.Match, error)
-	GetUnplayed() ([]*models.Match, error)
-	Create(match *models.Match) error
-	Update(match *models.Match) error
-	Delete(id int) error
+	GetAll(ctx context.Context) ([]*models.Match, error)
+	GetByID(ctx context.Context, id int) (*models.Match, error)
+	GetByWeek(ctx context.Context, week int) ([]*models.Match, error)
+	GetUnplayed(ctx context.Context) ([]*models.Match, error)
+	// Find returns one page of the matches selected by the filter and the number of matches selected
+	Find(ctx context.Context, filter *models.MatchFilter) ([]*models.Match, int, error)
+	Create(ctx context.Context, match *models.Match) error
+	Update(ctx context.Context, match *models.Match) error
+	Delete(ctx context.Context, id int) error
 }
 
 // LeagueRepository defines the methods that any league repository must implement
 type LeagueRepository interface {
-	GetCurrent() (*models.League, error)
-	Create(league *models.League) error
-	Update(league *models.League) error
-	GetCurrentWeek() (int, error)
-	GetTotalWeeks() (int, error)
-	UpdateWeek(week int) error
-	MarkAsCompleted() error
+	GetCurrent(ctx context.Context) (*models.League, error)
+	Create(ctx context.Context, league *models.League) error
+	Update(ctx context.Context, league *models.League) error
+	GetCurrentWeek(ctx context.Context) (int, error)
+	GetTotalWeeks(ctx context.Context) (int, error)
+	UpdateWeek(ctx context.Context, week int) error
+	MarkAsCompleted(ctx context.Context) error
+}
+
+// LeagueLock serializes the operations that change a league's results, across requests and app instances
+type LeagueLock interface {
+	// Lock waits until the league is free and returns the function that frees it again
+	Lock(ctx context.Context) (unlock func(), err error)
+	// TryLock takes the lock only when the league is free, and returns models.ErrLeagueBusy otherwise
+	TryLock(ctx context.Context) (unlock func(), err error)
+}
+
+// Transactor runs a group of repository calls atomically
+type Transactor interface {
+	// InTx runs fn in a transaction; the repositories take part when they are called with fn's context
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
-// Simulator defines the methods that any match simulator must implement
+// ScenarioRepository defines the methods that any scenario repository must implement
+type ScenarioRepository interface {
+	GetAll(ctx context.Context) ([]*models.Scenario, error)
+	GetByID(ctx context.Context, id int) (*models.Scenario, error)
+	Create(ctx context.Context, scenario *models.Scenario) error
+	Delete(ctx context.Context, id int) error
+}
+
+// APIKeyRepository defines the methods that any API key repository must implement
+type APIKeyRepository interface {
+	GetAll(ctx context.Context, tenantID int) ([]*models.APIKey, error)
+	GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	Create(ctx context.Context, key *models.APIKey) error
+	Delete(ctx context.Context, tenantID, id int) error
+}
+
+// IdempotencyRepository defines the methods that any idempotency key repository must implement
+type IdempotencyRepository interface {
+	// Reserve records a request under its key, taking over reservations that have not completed within lease
+	Reserve(ctx context.Context, record *models.IdempotencyRecord, window, lease time.Duration) (*models.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, record *models.IdempotencyRecord) error
+	Release(ctx context.Context, record *models.IdempotencyRecord) error
+}
+
+// JobRepository defines the methods that any job repository must implement.
+// Jobs of every tenant share one repository, so that a single worker pool can run them.
+type JobRepository interface {
+	GetRecent(ctx context.Context, tenantID, limit int) ([]*models.Job, error)
+	GetByID(ctx context.Context, tenantID, id int) (*models.Job, error)
+	Create(ctx context.Context, job *models.Job) error
+	// Claim starts the oldest queued job, or a running job whose worker stopped sending heartbeats
+	// for staleAfter; it returns nil when there is none
+	Claim(ctx context.Context, staleAfter time.Duration, maxAttempts int) (*models.Job, error)
+	// Heartbeat records a running job's progress and reports whether it should be cancelled
+	Heartbeat(ctx context.Context, job *models.Job) (cancelRequested bool, err error)
+	Finish(ctx context.Context, job *models.Job) error
+	Requeue(ctx context.Context, job *models.Job) error
+	RequestCancel(ctx context.Context, tenantID, id int) (*models.Job, error)
+}
+
+// TenantRepository defines the methods that any tenant repository must implement
+type TenantRepository interface {
+	GetAll(ctx context.Context) ([]*models.Tenant, error)
+	GetBySlug(ctx context.Context, slug string) (*models.Tenant, error)
+	GetByID(ctx context.Context, id int) (*models.Tenant, error)
+	Create(ctx context.Context, tenant *models.Tenant) error
+}
+
+// Simulator defines the methods that any match simulator must implement.
+// SimulateMatch does no I/O and so takes no context.
 type Simulator interface {
 	SimulateMatch(homeTeam, awayTeam *models.Team) (*models.Match, error)
-	SimulateWeek(week int) ([]*models.Match, error)
-	SimulateRemaining() ([]*models.Match, error)
+	SimulateWeek(ctx context.Context, week int) ([]*models.Match, error)
+	SimulateRemaining(ctx context.Context) ([]*models.Match, error)
+}
+
+// SeededSimulator is a Simulator that can draw from a caller's random source,
+// so that concurrent workers do not contend for a shared one
+type SeededSimulator interface {
+	Simulator
+	SimulateMatchWithRand(homeTeam, awayTeam *models.Team, rng *rand.Rand) (*models.Match, error)
+}
+
+// MatchEngine defines the methods that any probabilistic match model must implement
+type MatchEngine interface {
+	ScoreMatrix(homeTeam, awayTeam *models.Team) [][]float64
 }
 
 // Predictor defines the methods that any predictor must implement
 type Predictor interface {
-	PredictFinalTable() ([]*models.TeamStats, error)
+	PredictFinalTable(ctx context.Context) ([]*models.TeamStats, error)
+	PredictDistribution(ctx context.Context, pinned []*models.PinnedResult, runs int) (*models.TableDistribution, error)
 } 
\ No newline at end of file
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/footballsim/models"
+)
+
+var (
+	// ErrInvalidJob is returned for a job request that cannot be run
+	ErrInvalidJob = errors.New("invalid job")
+	// ErrJobNotFound is returned when a job does not exist in the tenant
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished is returned when cancelling a job that has already stopped
+	ErrJobFinished = errors.New("job has already finished")
+)
+
+const (
+	defaultPredictionJobRuns = 10000
+	maxPredictionJobRuns     = 100000
+	// recentJobs is the number of jobs listed per tenant
+	recentJobs = 50
+	// jobWeekTimeout bounds the simulation of a single week within a job
+	jobWeekTimeout = 30 * time.Second
+)
+
+// JobService submits, runs and cancels the background jobs of a single tenant
+type JobService struct {
+	JobRepo     JobRepository
+	TenantID    int
+	MatchRepo   MatchRepository
+	Simulator   Simulator
+	Predictor   Predictor
+	Experiments *ExperimentRunner
+	Lock        LeagueLock
+}
+
+// NewJobService creates a new job service for a tenant
+func NewJobService(jobRepo JobRepository, tenantID int, matchRepo MatchRepository, simulator Simulator, predictor Predictor, experiments *ExperimentRunner, lock LeagueLock) *JobService {
+	return &JobService{
+		JobRepo:     jobRepo,
+		TenantID:    tenantID,
+		MatchRepo:   matchRepo,
+		Simulator:   simulator,
+		Predictor:   predictor,
+		Experiments: experiments,
+		Lock:        lock,
+	}
+}
+
+// Submit checks a job request, fills in the defaults of its parameters and queues it
+func (s *JobService) Submit(ctx context.Context, request *models.JobRequest) (*models.Job, error) {
+	var params interface{}
+	switch request.Type {
+	case models.JobSimulateRemaining:
+		params = struct{}{}
+	case models.JobPrediction:
+		prediction := &models.PredictionJobParams{}
+		if err := decodeJobParams(request.Params, prediction); err != nil {
+			return nil, err
+		}
+		if prediction.Runs == 0 {
+			prediction.Runs = defaultPredictionJobRuns
+		}
+		if prediction.Runs < 1 || prediction.Runs > maxPredictionJobRuns {
+			return nil, fmt.Errorf("%w: runs must be between 1 and %d", ErrInvalidJob, maxPredictionJobRuns)
+		}
+		params = prediction
+	case models.JobExperiment:
+		config := &models.ExperimentConfig{}
+		if err := decodeJobParams(request.Params, config); err != nil {
+			return nil, err
+		}
+		if _, _, err := s.Experiments.configure(config); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+		}
+		params = config
+	default:
+		return nil, fmt.Errorf("%w: type must be one of %s, %s or %s", ErrInvalidJob, models.JobSimulateRemaining, models.JobPrediction, models.JobExperiment)
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.Job{
+		TenantID: s.TenantID,
+		Type:     request.Type,
+		Params:   encoded,
+		Status:   models.JobQueued,
+	}
+	if err := s.JobRepo.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// decodeJobParams reads a job's parameters, which may be left out to use the defaults
+func decodeJobParams(params json.RawMessage, target interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, target); err != nil {
+		return fmt.Errorf("%w: params: %v", ErrInvalidJob, err)
+	}
+	return nil
+}
+
+// Get returns a job of the tenant
+func (s *JobService) Get(ctx context.Context, id int) (*models.Job, error) {
+	job, err := s.JobRepo.GetByID(ctx, s.TenantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrJobNotFound, id)
+	}
+	return job, err
+}
+
+// List returns the tenant's most recent jobs, newest first
+func (s *JobService) List(ctx context.Context) ([]*models.Job, error) {
+	return s.JobRepo.GetRecent(ctx, s.TenantID, recentJobs)
+}
+
+// Cancel stops a job. A queued job is cancelled at once; a running job stops at its next heartbeat.
+func (s *JobService) Cancel(ctx context.Context, id int) (*models.Job, error) {
+	job, err := s.JobRepo.RequestCancel(ctx, s.TenantID, id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return job, err
+	}
+
+	// Nothing was cancelled: either there is no such job or it has already stopped
+	job, err = s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return job, fmt.Errorf("%w: it is %s", ErrJobFinished, job.Status)
+}
+
+// Run does the work of a job and returns its result. Progress is reported to the ProgressFunc of ctx.
+// A job stopped by ctx returns ctx's error, along with the partial result when there is one.
+func (s *JobService) Run(ctx context.Context, job *models.Job) (interface{}, error) {
+	switch job.Type {
+	case models.JobSimulateRemaining:
+		matches, err := s.simulateRemaining(ctx)
+		if matches == nil {
+			return nil, err
+		}
+		return matches, err
+	case models.JobPrediction:
+		params := &models.PredictionJobParams{}
+		if err := json.Unmarshal(job.Params, params); err != nil {
+			return nil, err
+		}
+		distribution, err := s.Predictor.PredictDistribution(ctx, nil, params.Runs)
+		if err != nil {
+			return nil, err
+		}
+		return distribution, ctx.Err()
+	case models.JobExperiment:
+		config := &models.ExperimentConfig{}
+		if err := json.Unmarshal(job.Params, config); err != nil {
+			return nil, err
+		}
+		report, err := s.Experiments.Run(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return report, nil
+	}
+	return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidJob, job.Type)
+}
+
+// simulateRemaining plays the remaining weeks one at a time, waiting for the league lock first.
+// Cancelling ctx stops the job between weeks, so that no week is left half played.
+func (s *JobService) simulateRemaining(ctx context.Context) (*models.SimulatedMatches, error) {
+	unlock, err := s.Lock.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	unplayedMatches, err := s.MatchRepo.GetUnplayed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	weekSet := make(map[int]bool)
+	for _, match := range unplayedMatches {
+		weekSet[match.Week] = true
+	}
+	weeks := make([]int, 0, len(weekSet))
+	for week := range weekSet {
+		weeks = append(weeks, week)
+	}
+	sort.Ints(weeks)
+
+	result := &models.SimulatedMatches{Matches: make([]*models.Match, 0, len(unplayedMatches))}
+	reportProgress(ctx, 0, len(weeks))
+	for i, week := range weeks {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		weekCtx, cancel := context.WithTimeout(context.Background(), jobWeekTimeout)
+		playedMatches, err := s.Simulator.SimulateWeek(weekCtx, week)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		result.Matches = append(result.Matches, playedMatches...)
+		reportProgress(ctx, i+1, len(weeks))
+	}
+	return result, nil
+}
+
+const (
+	// DefaultJobWorkers is the size of the worker pool when none is configured
+	DefaultJobWorkers = 2
+	// jobPollInterval is how often an idle worker looks for queued jobs
+	jobPollInterval = time.Second
+	// jobHeartbeatInterval is how often a running job's progress is stored and its cancellation checked
+	jobHeartbeatInterval = 2 * time.Second
+	// jobStaleAfter is how long a running job may go without a heartbeat before another worker takes it over
+	jobStaleAfter = 30 * time.Second
+	// maxJobAttempts is how many times a job is started before a job that keeps stopping its worker is given up
+	maxJobAttempts = 3
+)
+
+// JobQueue is the worker pool that runs the queued jobs of every tenant.
+// Jobs are claimed from the repository, so several app instances can share the queue,
+// and jobs interrupted by a shutdown or crash are run again.
+type JobQueue struct {
+	JobRepo JobRepository
+	Workers int
+	// Services returns the job service of a tenant, which does the actual work
+	Services func(ctx context.Context, tenantID int) (*JobService, error)
+}
+
+// NewJobQueue creates a new job queue with the given number of workers
+func NewJobQueue(jobRepo JobRepository, workers int, services func(ctx context.Context, tenantID int) (*JobService, error)) *JobQueue {
+	return &JobQueue{
+		JobRepo:  jobRepo,
+		Workers:  workers,
+		Services: services,
+	}
+}
+
+// Run starts the workers and blocks until ctx ends and they have stopped.
+// Jobs still running when ctx ends are put back in the queue.
+func (q *JobQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for worker := 0; worker < q.Workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work runs jobs one after another until ctx ends
+func (q *JobQueue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := q.JobRepo.Claim(ctx, jobStaleAfter, maxJobAttempts)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error claiming a job: %v", err)
+		}
+		if job != nil {
+			q.run(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// run runs a claimed job, sending heartbeats with its progress until it stops, and stores the outcome
+func (q *JobQueue) run(ctx context.Context, job *models.Job) {
+	var done, total int64
+	var cancelRequested, lost int32
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobCtx = WithProgress(jobCtx, func(d, t int) {
+		atomic.StoreInt64(&done, int64(d))
+		atomic.StoreInt64(&total, int64(t))
+	})
+	progress := func() models.JobProgress {
+		return models.JobProgress{Done: int(atomic.LoadInt64(&done)), Total: int(atomic.LoadInt64(&total))}
+	}
+
+	heartbeatDone := make(chan struct{})
+	stopHeartbeat := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopHeartbeat:
+				return
+			case <-ticker.C:
+			}
+
+			job.Progress = progress()
+			cancelled, err := q.JobRepo.Heartbeat(context.Background(), job)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				// Another worker took the job over after missed heartbeats
+				atomic.StoreInt32(&lost, 1)
+				cancel()
+			case err != nil:
+				log.Printf("Error sending heartbeat for job %d: %v", job.ID, err)
+			case cancelled:
+				atomic.StoreInt32(&cancelRequested, 1)
+				cancel()
+			}
+		}
+	}()
+
+	var result interface{}
+	service, err := q.Services(jobCtx, job.TenantID)
+	if err == nil {
+		result, err = service.Run(jobCtx, job)
+	}
+	close(stopHeartbeat)
+	<-heartbeatDone
+
+	if atomic.LoadInt32(&lost) == 1 {
+		return
+	}
+
+	// Work cut short by a shutdown is done again after the restart
+	finishCtx, cancelFinish := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFinish()
+	if ctx.Err() != nil && atomic.LoadInt32(&cancelRequested) == 0 {
+		if err := q.JobRepo.Requeue(finishCtx, job); err != nil {
+			log.Printf("Error requeueing job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	job.Progress = progress()
+	job.Status = models.JobSucceeded
+	switch {
+	case err != nil && atomic.LoadInt32(&cancelRequested) == 1 && errors.Is(err, context.Canceled):
+		job.Status = models.JobCancelled
+	case err != nil:
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+	}
+	if result != nil {
+		encoded, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			job.Status = models.JobFailed
+			job.Error = marshalErr.Error()
+		} else {
+			job.Result = encoded
+		}
+	}
+
+	if err := q.JobRepo.Finish(finishCtx, job); err != nil {
+		log.Printf("Error storing the outcome of job %d: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/user/footballsim/models"
+)
+
+// ErrInvalidTableView is returned for an unknown league table view
+var ErrInvalidTableView = errors.New("invalid table view")
+
+// LeagueService runs the league-wide operations shared by the API and the command line
+type LeagueService struct {
+	TeamRepo   TeamRepository
+	MatchRepo  MatchRepository
+	LeagueRepo LeagueRepository
+	Tx         Transactor
+}
+
+// NewLeagueService creates a new league service
+func NewLeagueService(teamRepo TeamRepository, matchRepo MatchRepository, leagueRepo LeagueRepository, tx Transactor) *LeagueService {
+	return &LeagueService{
+		TeamRepo:   teamRepo,
+		MatchRepo:  matchRepo,
+		LeagueRepo: leagueRepo,
+		Tx:         tx,
+	}
+}
+
+// Table returns the current league table, sorted by points, then goal difference, then goals for
+func (s *LeagueService) Table(ctx context.Context) ([]*models.TeamStats, error) {
+	teams, err := s.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	table := teamStatsFromTeams(teams)
+	sortTeamStats(table)
+	return table, nil
+}
+
+// TableView returns a league table computed from played matches: home or away matches only,
+// each team's last formMatches results, or the first or second half of the season.
+// It is sorted like the overall table, by points, then goal difference, then goals for.
+func (s *LeagueService) TableView(ctx context.Context, view string, formMatches int) ([]*models.TeamStats, error) {
+	if view == models.TableViewOverall {
+		return s.Table(ctx)
+	}
+
+	played := true
+	filter := &models.MatchFilter{Played: &played}
+	switch view {
+	case models.TableViewHome, models.TableViewAway, models.TableViewForm:
+	case models.TableViewFirstHalf, models.TableViewSecondHalf:
+		totalWeeks, err := s.LeagueRepo.GetTotalWeeks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if view == models.TableViewFirstHalf {
+			filter.WeekTo = (totalWeeks + 1) / 2
+		} else {
+			filter.WeekFrom = (totalWeeks+1)/2 + 1
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTableView, view)
+	}
+
+	teams, err := s.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := findAllMatches(ctx, s.MatchRepo, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Matches are in week order, so each team's form is its last results
+	results := make(map[int][]*models.TeamResult)
+	for _, match := range matches {
+		for _, teamID := range []int{match.HomeTeamID, match.AwayTeamID} {
+			result := match.ResultFor(teamID)
+			if (view == models.TableViewHome && result.Venue != models.VenueHome) ||
+				(view == models.TableViewAway && result.Venue != models.VenueAway) {
+				continue
+			}
+			results[teamID] = append(results[teamID], result)
+		}
+	}
+
+	table := make([]*models.TeamStats, len(teams))
+	for i, team := range teams {
+		teamResults := results[team.ID]
+		if view == models.TableViewForm && len(teamResults) > formMatches {
+			teamResults = teamResults[len(teamResults)-formMatches:]
+		}
+
+		var record models.TeamRecord
+		for _, result := range teamResults {
+			record.Add(result)
+		}
+		table[i] = &models.TeamStats{
+			TeamID:         team.ID,
+			TeamName:       team.Name,
+			Played:         record.Played,
+			Won:            record.Won,
+			Drawn:          record.Drawn,
+			Lost:           record.Lost,
+			GoalsFor:       record.GoalsFor,
+			GoalsAgainst:   record.GoalsAgainst,
+			GoalDifference: record.GoalsFor - record.GoalsAgainst,
+			Points:         record.Points,
+		}
+	}
+
+	sortTeamStats(table)
+	return table, nil
+}
+
+// Reset clears all results and standings and moves the league back to week 1.
+// It runs in one transaction, so a failed reset leaves the league as it was.
+func (s *LeagueService) Reset(ctx context.Context) error {
+	return s.Tx.InTx(ctx, s.reset)
+}
+
+// reset does the work of Reset within its transaction
+func (s *LeagueService) reset(ctx context.Context) error {
+	// Get current league
+	league, err := s.LeagueRepo.GetCurrent(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Reset all teams
+	teams, err := s.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	// A team updated concurrently, for example renamed, is read again and cleared rather than failing the reset
+	for _, team := range teams {
+		err := ApplyTeamChange(ctx, s.TeamRepo, team, func(team *models.Team) {
+			team.Played = 0
+			team.Won = 0
+			team.Drawn = 0
+			team.Lost = 0
+			team.GoalsFor = 0
+			team.GoalsAgainst = 0
+			team.GoalDifference = 0
+			team.Points = 0
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Reset all matches
+	matches, err := s.MatchRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		match.HomeTeamGoals = 0
+		match.AwayTeamGoals = 0
+		match.Played = false
+		match.IsEdited = false
+
+		if err := s.MatchRepo.Update(ctx, match); err != nil {
+			return err
+		}
+	}
+
+	// Reset league to week 1
+	league.CurrentWeek = 1
+	league.IsCompleted = false
+	return s.LeagueRepo.Update(ctx, league)
+}
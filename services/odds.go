@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/user/footballsim/models"
+)
+
+// ErrMatchAlreadyPlayed is returned when odds are requested for a match that has a result
+var ErrMatchAlreadyPlayed = errors.New("match has already been played")
+
+// mostLikelyScoresCount is the number of scorelines listed in match odds
+const mostLikelyScoresCount = 5
+
+// OddsCalculator computes outcome probabilities for fixtures from the active match engine
+type OddsCalculator struct {
+	TeamRepo TeamRepository
+	Engine   MatchEngine
+}
+
+// NewOddsCalculator creates a new odds calculator
+func NewOddsCalculator(teamRepo TeamRepository, engine MatchEngine) *OddsCalculator {
+	return &OddsCalculator{
+		TeamRepo: teamRepo,
+		Engine:   engine,
+	}
+}
+
+// MatchOdds returns the outcome probabilities of an unplayed match
+func (o *OddsCalculator) MatchOdds(ctx context.Context, match *models.Match) (*models.MatchOdds, error) {
+	if match.Played {
+		return nil, ErrMatchAlreadyPlayed
+	}
+
+	homeTeam, err := o.TeamRepo.GetByID(ctx, match.HomeTeamID)
+	if err != nil {
+		return nil, err
+	}
+
+	awayTeam, err := o.TeamRepo.GetByID(ctx, match.AwayTeamID)
+	if err != nil {
+		return nil, err
+	}
+
+	odds := o.FixtureOdds(homeTeam, awayTeam)
+	odds.MatchID = match.ID
+	odds.Week = match.Week
+
+	return odds, nil
+}
+
+// FixtureOdds returns the outcome probabilities of a meeting between two teams
+func (o *OddsCalculator) FixtureOdds(homeTeam, awayTeam *models.Team) *models.MatchOdds {
+	matrix := o.Engine.ScoreMatrix(homeTeam, awayTeam)
+	homeWin, draw, awayWin := outcomeProbabilities(matrix)
+
+	odds := &models.MatchOdds{
+		HomeTeamID:   homeTeam.ID,
+		AwayTeamID:   awayTeam.ID,
+		HomeTeamName: homeTeam.Name,
+		AwayTeamName: awayTeam.Name,
+		HomeWin:      homeWin,
+		Draw:         draw,
+		AwayWin:      awayWin,
+		Odds: models.DecimalOdds{
+			HomeWin: fairOdds(homeWin),
+			Draw:    fairOdds(draw),
+			AwayWin: fairOdds(awayWin),
+		},
+		ScoreMatrix: matrix,
+	}
+
+	scores := make([]*models.ScorelineProbability, 0)
+	for h, row := range matrix {
+		for a, p := range row {
+			odds.ExpectedHomeGoals += float64(h) * p
+			odds.ExpectedAwayGoals += float64(a) * p
+			scores = append(scores, &models.ScorelineProbability{
+				HomeTeamGoals: h,
+				AwayTeamGoals: a,
+				Probability:   p,
+			})
+		}
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Probability > scores[j].Probability
+	})
+	if len(scores) > mostLikelyScoresCount {
+		scores = scores[:mostLikelyScoresCount]
+	}
+	odds.MostLikelyScores = scores
+
+	return odds
+}
+
+// fairOdds returns the decimal odds without a bookmaker margin, or 0 for an impossible outcome
+func fairOdds(probability float64) float64 {
+	if probability <= 0 {
+		return 0
+	}
+	return 1 / probability
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+
+	"github.com/user/footballsim/models"
+)
+
+// DefaultTopN is the top-N finish tracked by the season outlook when none is requested
+const DefaultTopN = 4
+
+// OutlookAnalyzer works out what each team can still achieve from the current table and the remaining fixtures.
+// The position bounds are conservative: a clinch or elimination is only reported once it is certain,
+// and ties on points are always counted against the team because tie-breakers are not yet known.
+type OutlookAnalyzer struct {
+	TeamRepo  TeamRepository
+	MatchRepo MatchRepository
+}
+
+// NewOutlookAnalyzer creates a new outlook analyzer
+func NewOutlookAnalyzer(teamRepo TeamRepository, matchRepo MatchRepository) *OutlookAnalyzer {
+	return &OutlookAnalyzer{
+		TeamRepo:  teamRepo,
+		MatchRepo: matchRepo,
+	}
+}
+
+// Analyze returns the outlook of every team, in current table order
+func (a *OutlookAnalyzer) Analyze(ctx context.Context, topN int) ([]*models.TeamOutlook, error) {
+	teams, err := a.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unplayedMatches, err := a.MatchRepo.GetUnplayed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return analyzeOutlook(teams, unplayedMatches, topN), nil
+}
+
+// analyzeOutlook computes the points and position bounds of each team
+func analyzeOutlook(teams []*models.Team, unplayedMatches []*models.Match, topN int) []*models.TeamOutlook {
+	remaining := make(map[int]int)
+	for _, match := range unplayedMatches {
+		remaining[match.HomeTeamID]++
+		remaining[match.AwayTeamID]++
+	}
+
+	outlooks := make([]*models.TeamOutlook, len(teams))
+	for i, team := range teams {
+		outlooks[i] = &models.TeamOutlook{
+			TeamID:    team.ID,
+			TeamName:  team.Name,
+			Points:    team.Points,
+			Remaining: remaining[team.ID],
+			MinPoints: team.Points,
+			MaxPoints: team.Points + 3*remaining[team.ID],
+			TopN:      topN,
+		}
+	}
+
+	for _, outlook := range outlooks {
+		outlook.BestPosition = 1
+		outlook.WorstPosition = 1
+		highestRivalMax := 0
+
+		for _, rival := range outlooks {
+			if rival.TeamID == outlook.TeamID {
+				continue
+			}
+			// The rival finishes above even if it loses everything and we win everything
+			if rival.MinPoints > outlook.MaxPoints {
+				outlook.BestPosition++
+			}
+			// The rival can catch us if it wins everything and we lose everything
+			if rival.MaxPoints >= outlook.MinPoints {
+				outlook.WorstPosition++
+			}
+			if rival.MaxPoints > highestRivalMax {
+				highestRivalMax = rival.MaxPoints
+			}
+		}
+
+		outlook.TitleClinched = outlook.WorstPosition == 1
+		outlook.TitleEliminated = outlook.BestPosition > 1
+		outlook.TopNClinched = outlook.WorstPosition <= topN
+		outlook.TopNEliminated = outlook.BestPosition > topN
+
+		// Points we still need so that no rival can reach our total
+		needed := highestRivalMax - outlook.Points + 1
+		if needed < 0 {
+			needed = 0
+		}
+		if needed <= 3*outlook.Remaining {
+			outlook.MagicNumber = &needed
+		}
+	}
+
+	return outlooks
+}
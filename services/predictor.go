@@ -1,8 +1,16 @@
 package services
 
 import (
+	"context"
+	"math"
+	"math/rand"
+	"runtime"
 	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/user/footballsim/metrics"
 	"github.com/user/footballsim/models"
 )
 
@@ -12,6 +20,8 @@ type TablePredictor struct {
 	MatchRepo  MatchRepository
 	LeagueRepo LeagueRepository
 	Simulator  Simulator
+	// Workers is the number of goroutines that share the runs of a distribution
+	Workers int
 }
 
 // NewTablePredictor creates a new table predictor
@@ -21,17 +31,109 @@ func NewTablePredictor(teamRepo TeamRepository, matchRepo MatchRepository, leagu
 		MatchRepo:  matchRepo,
 		LeagueRepo: leagueRepo,
 		Simulator:  simulator,
+		Workers:    runtime.NumCPU(),
 	}
 }
 
 // PredictFinalTable predicts the final league table based on current standings and team strengths
-func (p *TablePredictor) PredictFinalTable() ([]*models.TeamStats, error) {
+func (p *TablePredictor) PredictFinalTable(ctx context.Context) ([]*models.TeamStats, error) {
 	// Get all teams
-	teams, err := p.TeamRepo.GetAll()
+	teams, err := p.TeamRepo.GetAll(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// Get matches that have not been played yet
+	unplayedMatches, err := p.MatchRepo.GetUnplayed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.PredictionRuns.Inc()
+	return p.simulateFinalTable(teams, unplayedMatches, nil, nil)
+}
+
+// PredictDistribution simulates the rest of the season runs times, using the pinned
+// results in place of simulation for those matches, and returns the final table distribution.
+// The runs are shared by a pool of workers, each with its own random source. When ctx is
+// cancelled or its deadline passes, the runs finished so far are returned as a partial
+// distribution; ctx's error is only returned if no run finished at all.
+// Finished runs are reported to the ProgressFunc of ctx.
+func (p *TablePredictor) PredictDistribution(ctx context.Context, pinned []*models.PinnedResult, runs int) (*models.TableDistribution, error) {
+	teams, err := p.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unplayedMatches, err := p.MatchRepo.GetUnplayed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pinnedByMatch := make(map[int]*models.PinnedResult)
+	for _, result := range pinned {
+		pinnedByMatch[result.MatchID] = result
+	}
+
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > runs {
+		workers = runs
+	}
+
+	// Workers claim runs one at a time so that they stop together at the deadline
+	var claimed, finished int64
+	seed := time.Now().UnixNano()
+	results := make([]*tableDistribution, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(worker)))
+			distribution := newTableDistribution(teams)
+			results[worker] = distribution
+			for ctx.Err() == nil && atomic.AddInt64(&claimed, 1) <= int64(runs) {
+				table, err := p.simulateFinalTable(teams, unplayedMatches, pinnedByMatch, rng)
+				if err != nil {
+					errs[worker] = err
+					return
+				}
+				distribution.Add(table)
+				reportProgress(ctx, int(atomic.AddInt64(&finished, 1)), runs)
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	distribution := newTableDistribution(teams)
+	for _, result := range results {
+		distribution.Merge(result)
+	}
+	metrics.PredictionRuns.Add(float64(distribution.runs))
+	if distribution.runs == 0 && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	result := distribution.Result()
+	result.RequestedRuns = runs
+	result.Partial = distribution.runs < runs
+	return result, nil
+}
+
+// simulateFinalTable plays the unplayed matches on copies of the teams and returns the
+// sorted final table. Matches with a pinned result use that score instead of a simulation.
+// rng is the caller's random source, or nil to use the simulator's own.
+func (p *TablePredictor) simulateFinalTable(teams []*models.Team, unplayedMatches []*models.Match, pinned map[int]*models.PinnedResult, rng *rand.Rand) ([]*models.TeamStats, error) {
 	// Create copies of teams for prediction
 	teamCopies := make([]*models.Team, len(teams))
 	for i, team := range teams {
@@ -39,12 +141,6 @@ func (p *TablePredictor) PredictFinalTable() ([]*models.TeamStats, error) {
 		teamCopies[i] = &teamCopy
 	}
 
-	// Get matches that have not been played yet
-	unplayedMatches, err := p.MatchRepo.GetUnplayed()
-	if err != nil {
-		return nil, err
-	}
-
 	// Create a map of team ID to team object for easy lookup
 	teamMap := make(map[int]*models.Team)
 	for _, team := range teamCopies {
@@ -56,8 +152,16 @@ func (p *TablePredictor) PredictFinalTable() ([]*models.TeamStats, error) {
 		homeTeam := teamMap[match.HomeTeamID]
 		awayTeam := teamMap[match.AwayTeamID]
 
+		if result, ok := pinned[match.ID]; ok {
+			updateTeamStats(homeTeam, awayTeam, &models.Match{
+				HomeTeamGoals: result.HomeTeamGoals,
+				AwayTeamGoals: result.AwayTeamGoals,
+			})
+			continue
+		}
+
 		// Simulate the match
-		simulatedMatch, err := p.Simulator.SimulateMatch(homeTeam, awayTeam)
+		simulatedMatch, err := simulateMatchWithRand(p.Simulator, homeTeam, awayTeam, rng)
 		if err != nil {
 			return nil, err
 		}
@@ -67,8 +171,16 @@ func (p *TablePredictor) PredictFinalTable() ([]*models.TeamStats, error) {
 	}
 
 	// Convert team data to team stats
-	teamStats := make([]*models.TeamStats, len(teamCopies))
-	for i, team := range teamCopies {
+	teamStats := teamStatsFromTeams(teamCopies)
+	sortTeamStats(teamStats)
+
+	return teamStats, nil
+}
+
+// teamStatsFromTeams converts teams to unsorted table rows
+func teamStatsFromTeams(teams []*models.Team) []*models.TeamStats {
+	teamStats := make([]*models.TeamStats, len(teams))
+	for i, team := range teams {
 		teamStats[i] = &models.TeamStats{
 			TeamID:         team.ID,
 			TeamName:       team.Name,
@@ -82,8 +194,11 @@ func (p *TablePredictor) PredictFinalTable() ([]*models.TeamStats, error) {
 			Points:         team.Points,
 		}
 	}
+	return teamStats
+}
 
-	// Sort the teams by points, then goal difference, then goals for
+// sortTeamStats sorts the teams by points, then goal difference, then goals for
+func sortTeamStats(teamStats []*models.TeamStats) {
 	sort.Slice(teamStats, func(i, j int) bool {
 		if teamStats[i].Points != teamStats[j].Points {
 			return teamStats[i].Points > teamStats[j].Points
@@ -93,6 +208,139 @@ func (p *TablePredictor) PredictFinalTable() ([]*models.TeamStats, error) {
 		}
 		return teamStats[i].GoalsFor > teamStats[j].GoalsFor
 	})
+}
 
-	return teamStats, nil
-} 
\ No newline at end of file
+// tableDistribution accumulates simulated final tables
+type tableDistribution struct {
+	runs        int
+	teams       []*models.Team
+	points      map[int]int
+	goalDiff    map[int]int
+	positionSum map[int]int
+	positions   map[int][]int
+	pointRuns   map[int][]int
+}
+
+// newTableDistribution creates an empty distribution for the given teams
+func newTableDistribution(teams []*models.Team) *tableDistribution {
+	d := &tableDistribution{
+		teams:       teams,
+		points:      make(map[int]int),
+		goalDiff:    make(map[int]int),
+		positionSum: make(map[int]int),
+		positions:   make(map[int][]int),
+		pointRuns:   make(map[int][]int),
+	}
+	for _, team := range teams {
+		d.positions[team.ID] = make([]int, len(teams))
+	}
+	return d
+}
+
+// Add records one sorted final table
+func (d *tableDistribution) Add(table []*models.TeamStats) {
+	d.runs++
+	for position, stats := range table {
+		d.points[stats.TeamID] += stats.Points
+		d.goalDiff[stats.TeamID] += stats.GoalDifference
+		d.positionSum[stats.TeamID] += position + 1
+		d.positions[stats.TeamID][position]++
+		d.pointRuns[stats.TeamID] = append(d.pointRuns[stats.TeamID], stats.Points)
+	}
+}
+
+// Merge adds the runs recorded by another distribution of the same teams
+func (d *tableDistribution) Merge(other *tableDistribution) {
+	d.runs += other.runs
+	for _, team := range d.teams {
+		d.points[team.ID] += other.points[team.ID]
+		d.goalDiff[team.ID] += other.goalDiff[team.ID]
+		d.positionSum[team.ID] += other.positionSum[team.ID]
+		for position, count := range other.positions[team.ID] {
+			d.positions[team.ID][position] += count
+		}
+		d.pointRuns[team.ID] = append(d.pointRuns[team.ID], other.pointRuns[team.ID]...)
+	}
+}
+
+// Result returns the distribution ordered by expected position
+func (d *tableDistribution) Result() *models.TableDistribution {
+	result := &models.TableDistribution{
+		Runs:  d.runs,
+		Teams: make([]*models.TeamDistribution, 0, len(d.teams)),
+	}
+	if d.runs == 0 {
+		return result
+	}
+
+	runs := float64(d.runs)
+	for _, team := range d.teams {
+		probabilities := make([]float64, len(d.teams))
+		for i, count := range d.positions[team.ID] {
+			probabilities[i] = float64(count) / runs
+			result.ErrorBound = math.Max(result.ErrorBound, marginOfError(probabilities[i], d.runs))
+		}
+
+		result.Teams = append(result.Teams, &models.TeamDistribution{
+			TeamID:                team.ID,
+			TeamName:              team.Name,
+			AveragePoints:         float64(d.points[team.ID]) / runs,
+			AverageGoalDifference: float64(d.goalDiff[team.ID]) / runs,
+			ExpectedPosition:      float64(d.positionSum[team.ID]) / runs,
+			TitleProbability:      probabilities[0],
+			PositionProbabilities: probabilities,
+			PointsInterval:        pointsInterval(d.pointRuns[team.ID]),
+			PositionInterval:      positionInterval(d.positions[team.ID], d.runs),
+		})
+	}
+
+	sort.SliceStable(result.Teams, func(i, j int) bool {
+		return result.Teams[i].ExpectedPosition < result.Teams[j].ExpectedPosition
+	})
+
+	return result
+}
+
+// marginOfError returns the 95% margin of error of a probability estimated from runs samples
+func marginOfError(probability float64, runs int) float64 {
+	return 1.96 * math.Sqrt(probability*(1-probability)/float64(runs))
+}
+
+// intervalTail is the share of runs left out on each side of a reported interval
+const intervalTail = 0.05
+
+// pointsInterval returns the central 90% range of the simulated points totals
+func pointsInterval(points []int) [2]int {
+	if len(points) == 0 {
+		return [2]int{}
+	}
+
+	sorted := append([]int(nil), points...)
+	sort.Ints(sorted)
+
+	last := float64(len(sorted) - 1)
+	return [2]int{
+		sorted[int(math.Floor(intervalTail*last))],
+		sorted[int(math.Ceil((1-intervalTail)*last))],
+	}
+}
+
+// positionInterval returns the central 90% range of the simulated final positions
+func positionInterval(counts []int, runs int) [2]int {
+	interval := [2]int{1, len(counts)}
+	cumulative := 0
+	lowFound := false
+	for i, count := range counts {
+		cumulative += count
+		share := float64(cumulative) / float64(runs)
+		if !lowFound && share > intervalTail {
+			interval[0] = i + 1
+			lowFound = true
+		}
+		if share >= 1-intervalTail {
+			interval[1] = i + 1
+			break
+		}
+	}
+	return interval
+}
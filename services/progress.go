@@ -0,0 +1,23 @@
+package services
+
+import "context"
+
+// ProgressFunc receives the units of work done so far out of total.
+// It may be called from several goroutines at once.
+type ProgressFunc func(done, total int)
+
+// progressKey is the context key holding a ProgressFunc
+type progressKey struct{}
+
+// WithProgress returns a context through which long operations, such as distributions and experiments,
+// report their progress to report
+func WithProgress(ctx context.Context, report ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// reportProgress passes progress to the ProgressFunc of ctx, if it has one
+func reportProgress(ctx context.Context, done, total int) {
+	if report, ok := ctx.Value(progressKey{}).(ProgressFunc); ok {
+		report(done, total)
+	}
+}
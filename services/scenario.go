@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/user/footballsim/models"
+)
+
+var (
+	// ErrInvalidScenario is returned when a scenario cannot be simulated
+	ErrInvalidScenario = errors.New("invalid scenario")
+	// ErrScenarioNotFound is returned when a saved scenario does not exist
+	ErrScenarioNotFound = errors.New("scenario not found")
+)
+
+const (
+	defaultScenarioRuns = 1000
+	maxScenarioRuns     = 10000
+)
+
+// ScenarioService runs what-if scenarios on in-memory copies of the league
+type ScenarioService struct {
+	ScenarioRepo ScenarioRepository
+	MatchRepo    MatchRepository
+	Predictor    *TablePredictor
+}
+
+// NewScenarioService creates a new scenario service
+func NewScenarioService(scenarioRepo ScenarioRepository, matchRepo MatchRepository, predictor *TablePredictor) *ScenarioService {
+	return &ScenarioService{
+		ScenarioRepo: scenarioRepo,
+		MatchRepo:    matchRepo,
+		Predictor:    predictor,
+	}
+}
+
+// Run simulates the rest of the season with the scenario's pinned results without saving anything.
+// The distribution is partial if ctx ends before all runs are done.
+func (s *ScenarioService) Run(ctx context.Context, scenario *models.Scenario) (*models.ScenarioResult, error) {
+	return s.run(ctx, scenario, false)
+}
+
+// Save stores the scenario so that it can be shared by ID, then runs it
+func (s *ScenarioService) Save(ctx context.Context, scenario *models.Scenario) (*models.ScenarioResult, error) {
+	if _, err := s.validate(ctx, scenario, false); err != nil {
+		return nil, err
+	}
+
+	if err := s.ScenarioRepo.Create(ctx, scenario); err != nil {
+		return nil, err
+	}
+
+	return s.Run(ctx, scenario)
+}
+
+// RunSaved loads a saved scenario and runs it against the current league state.
+// Pins on matches played since the scenario was saved are skipped and listed in the result.
+func (s *ScenarioService) RunSaved(ctx context.Context, id int) (*models.ScenarioResult, error) {
+	scenario, err := s.ScenarioRepo.GetByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrScenarioNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.run(ctx, scenario, true)
+}
+
+// run validates the scenario and simulates the rest of the season with its pins.
+// With skipPlayed, pins on matches that are no longer unplayed are skipped instead of being an error.
+func (s *ScenarioService) run(ctx context.Context, scenario *models.Scenario, skipPlayed bool) (*models.ScenarioResult, error) {
+	skipped, err := s.validate(ctx, scenario, skipPlayed)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := scenario.PinnedResults
+	if len(skipped) > 0 {
+		pinned = make([]*models.PinnedResult, 0, len(scenario.PinnedResults))
+		for _, result := range scenario.PinnedResults {
+			if !skipped[result.MatchID] {
+				pinned = append(pinned, result)
+			}
+		}
+	}
+
+	distribution, err := s.Predictor.PredictDistribution(ctx, pinned, scenario.Runs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ScenarioResult{
+		Scenario:       scenario,
+		Distribution:   distribution,
+		SkippedMatches: skippedMatchIDs(scenario.PinnedResults, skipped),
+	}, nil
+}
+
+// validate checks that every pinned result refers to a distinct unplayed match and fills in defaults.
+// With skipPlayed, it returns the IDs of the pinned matches that are no longer unplayed instead of failing.
+func (s *ScenarioService) validate(ctx context.Context, scenario *models.Scenario, skipPlayed bool) (map[int]bool, error) {
+	if models.NameTooLong(scenario.Name) {
+		return nil, fmt.Errorf("%w: name must be at most %d characters long", ErrInvalidScenario, models.MaxNameLength)
+	}
+	if scenario.Runs == 0 {
+		scenario.Runs = defaultScenarioRuns
+	}
+	if scenario.Runs < 1 || scenario.Runs > maxScenarioRuns {
+		return nil, fmt.Errorf("%w: runs must be between 1 and %d", ErrInvalidScenario, maxScenarioRuns)
+	}
+	if scenario.PinnedResults == nil {
+		scenario.PinnedResults = make([]*models.PinnedResult, 0)
+	}
+
+	unplayedMatches, err := s.MatchRepo.GetUnplayed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unplayed := make(map[int]bool)
+	for _, match := range unplayedMatches {
+		unplayed[match.ID] = true
+	}
+
+	seen := make(map[int]bool)
+	skipped := make(map[int]bool)
+	for _, result := range scenario.PinnedResults {
+		if result == nil {
+			return nil, fmt.Errorf("%w: empty pinned result", ErrInvalidScenario)
+		}
+		if seen[result.MatchID] {
+			return nil, fmt.Errorf("%w: match %d is pinned more than once", ErrInvalidScenario, result.MatchID)
+		}
+		if result.HomeTeamGoals < 0 || result.AwayTeamGoals < 0 {
+			return nil, fmt.Errorf("%w: match %d has negative goals", ErrInvalidScenario, result.MatchID)
+		}
+		seen[result.MatchID] = true
+
+		if !unplayed[result.MatchID] {
+			if !skipPlayed {
+				return nil, fmt.Errorf("%w: match %d is not an unplayed match", ErrInvalidScenario, result.MatchID)
+			}
+			skipped[result.MatchID] = true
+		}
+	}
+
+	return skipped, nil
+}
+
+// skippedMatchIDs returns the IDs of the skipped pins in the scenario's order
+func skippedMatchIDs(pinned []*models.PinnedResult, skipped map[int]bool) []int {
+	ids := make([]int, 0, len(skipped))
+	for _, result := range pinned {
+		if skipped[result.MatchID] {
+			ids = append(ids, result.MatchID)
+		}
+	}
+	return ids
+}
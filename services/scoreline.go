@@ -0,0 +1,84 @@
+package services
+
+import "math"
+
+// maxScorelineGoals is the highest goal count per team kept in a scoreline matrix
+const maxScorelineGoals = 10
+
+// poissonPMF returns the probability of exactly k goals for a scoring rate of lambda
+func poissonPMF(k int, lambda float64) float64 {
+	if lambda <= 0 {
+		if k == 0 {
+			return 1
+		}
+		return 0
+	}
+	logP := float64(k)*math.Log(lambda) - lambda
+	for i := 2; i <= k; i++ {
+		logP -= math.Log(float64(i))
+	}
+	return math.Exp(logP)
+}
+
+// dixonColesTau returns the Dixon-Coles correction factor for low scorelines
+func dixonColesTau(homeGoals, awayGoals int, lambda, mu, rho float64) float64 {
+	switch {
+	case homeGoals == 0 && awayGoals == 0:
+		return 1 - lambda*mu*rho
+	case homeGoals == 0 && awayGoals == 1:
+		return 1 + lambda*rho
+	case homeGoals == 1 && awayGoals == 0:
+		return 1 + mu*rho
+	case homeGoals == 1 && awayGoals == 1:
+		return 1 - rho
+	}
+	return 1
+}
+
+// dixonColesMatrix returns the scoreline probabilities for the given home and away scoring rates
+func dixonColesMatrix(lambda, mu, rho float64) [][]float64 {
+	matrix := make([][]float64, maxScorelineGoals+1)
+	for h := range matrix {
+		matrix[h] = make([]float64, maxScorelineGoals+1)
+		for a := range matrix[h] {
+			matrix[h][a] = dixonColesTau(h, a, lambda, mu, rho) * poissonPMF(h, lambda) * poissonPMF(a, mu)
+		}
+	}
+	normaliseMatrix(matrix)
+	return matrix
+}
+
+// normaliseMatrix rescales a scoreline matrix so that its probabilities sum to one
+func normaliseMatrix(matrix [][]float64) {
+	total := 0.0
+	for _, row := range matrix {
+		for _, p := range row {
+			total += p
+		}
+	}
+	if total <= 0 {
+		return
+	}
+	for _, row := range matrix {
+		for a := range row {
+			row[a] /= total
+		}
+	}
+}
+
+// outcomeProbabilities returns the home win, draw and away win probabilities of a scoreline matrix
+func outcomeProbabilities(matrix [][]float64) (homeWin, draw, awayWin float64) {
+	for h, row := range matrix {
+		for a, p := range row {
+			switch {
+			case h > a:
+				homeWin += p
+			case h < a:
+				awayWin += p
+			default:
+				draw += p
+			}
+		}
+	}
+	return
+}
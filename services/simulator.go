@@ -1,35 +1,60 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"math/rand"
 	"time"
 	"log"
 
+	"github.com/user/footballsim/metrics"
 	"github.com/user/footballsim/models"
 )
 
+// ErrInvalidWeek is returned when a week is outside the league's season
+var ErrInvalidWeek = errors.New("invalid week")
+
+// DefaultHomeAdvantage is the chance added to each scoring chance of the home team
+const DefaultHomeAdvantage = 0.1
+
 // MatchSimulator implements the Simulator interface
 type MatchSimulator struct {
-	TeamRepo   TeamRepository
-	MatchRepo  MatchRepository
-	LeagueRepo LeagueRepository
+	TeamRepo      TeamRepository
+	MatchRepo     MatchRepository
+	LeagueRepo    LeagueRepository
+	Tx            Transactor
+	HomeAdvantage float64
 }
 
 // NewMatchSimulator creates a new match simulator
-func NewMatchSimulator(teamRepo TeamRepository, matchRepo MatchRepository, leagueRepo LeagueRepository) *MatchSimulator {
+func NewMatchSimulator(teamRepo TeamRepository, matchRepo MatchRepository, leagueRepo LeagueRepository, tx Transactor) *MatchSimulator {
 	rand.Seed(time.Now().UnixNano())
 	return &MatchSimulator{
-		TeamRepo:   teamRepo,
-		MatchRepo:  matchRepo,
-		LeagueRepo: leagueRepo,
+		TeamRepo:      teamRepo,
+		MatchRepo:     matchRepo,
+		LeagueRepo:    leagueRepo,
+		Tx:            tx,
+		HomeAdvantage: DefaultHomeAdvantage,
 	}
 }
 
 // SimulateMatch simulates a match between two teams
 func (s *MatchSimulator) SimulateMatch(homeTeam, awayTeam *models.Team) (*models.Match, error) {
+	return s.simulateMatch(homeTeam, awayTeam, rand.Float64), nil
+}
+
+// SimulateMatchWithRand simulates a match drawing from rng, which must not be shared between goroutines
+func (s *MatchSimulator) SimulateMatchWithRand(homeTeam, awayTeam *models.Team, rng *rand.Rand) (*models.Match, error) {
+	return s.simulateMatch(homeTeam, awayTeam, rng.Float64), nil
+}
+
+// simulateMatch simulates a match using random for the scoring chances
+func (s *MatchSimulator) simulateMatch(homeTeam, awayTeam *models.Team, random func() float64) *models.Match {
 	// Simulate based on team strength
-	homeTeamGoals := simulateGoals(homeTeam.Strength, true)
-	awayTeamGoals := simulateGoals(awayTeam.Strength, false)
+	homeTeamGoals := simulateGoals(homeTeam, awayTeam, s.HomeAdvantage, random)
+	awayTeamGoals := simulateGoals(awayTeam, homeTeam, 0, random)
 
 	match := &models.Match{
 		HomeTeamID:    homeTeam.ID,
@@ -42,14 +67,23 @@ func (s *MatchSimulator) SimulateMatch(homeTeam, awayTeam *models.Team) (*models
 		PlayedAt:      time.Now(),
 	}
 
-	return match, nil
+	return match
 }
 
 // SimulateWeek simulates all matches for a specific week
-func (s *MatchSimulator) SimulateWeek(week int) ([]*models.Match, error) {
+func (s *MatchSimulator) SimulateWeek(ctx context.Context, week int) ([]*models.Match, error) {
 	log.Printf("SimulateWeek called for week %d", week)
+
+	totalWeeks, err := s.LeagueRepo.GetTotalWeeks(ctx)
+	if err != nil {
+		log.Printf("Error getting total weeks: %v", err)
+		return nil, err
+	}
+	if week < 1 || week > totalWeeks {
+		return nil, fmt.Errorf("%w: week must be between 1 and %d", ErrInvalidWeek, totalWeeks)
+	}
 	
-	matches, err := s.MatchRepo.GetByWeek(week)
+	matches, err := s.MatchRepo.GetByWeek(ctx, week)
 	if err != nil {
 		log.Printf("Error getting matches for week %d: %v", week, err)
 		return nil, err
@@ -67,13 +101,13 @@ func (s *MatchSimulator) SimulateWeek(week int) ([]*models.Match, error) {
 
 		log.Printf("Simulating match: %s vs %s", match.HomeTeamName, match.AwayTeamName)
 		
-		homeTeam, err := s.TeamRepo.GetByID(match.HomeTeamID)
+		homeTeam, err := s.TeamRepo.GetByID(ctx, match.HomeTeamID)
 		if err != nil {
 			log.Printf("Error getting home team (ID: %d): %v", match.HomeTeamID, err)
 			return nil, err
 		}
 
-		awayTeam, err := s.TeamRepo.GetByID(match.AwayTeamID)
+		awayTeam, err := s.TeamRepo.GetByID(ctx, match.AwayTeamID)
 		if err != nil {
 			log.Printf("Error getting away team (ID: %d): %v", match.AwayTeamID, err)
 			return nil, err
@@ -94,33 +128,42 @@ func (s *MatchSimulator) SimulateWeek(week int) ([]*models.Match, error) {
 		log.Printf("Updating match in database: %s %d-%d %s", 
 			match.HomeTeamName, match.HomeTeamGoals, match.AwayTeamGoals, match.AwayTeamName)
 		
-		err = s.MatchRepo.Update(match)
-		if err != nil {
-			log.Printf("Error updating match: %v", err)
-			return nil, err
-		}
-
-		// Update team stats
-		log.Printf("Updating team stats for %s and %s", homeTeam.Name, awayTeam.Name)
-		updateTeamStats(homeTeam, awayTeam, match)
+		// The match and both teams change together or not at all. The standings are reapplied when
+		// a team was updated concurrently, for example renamed, so that the week is not abandoned.
+		err = s.Tx.InTx(ctx, func(ctx context.Context) error {
+			if err := s.MatchRepo.Update(ctx, match); err != nil {
+				log.Printf("Error updating match: %v", err)
+				return err
+			}
 
-		err = s.TeamRepo.Update(homeTeam)
-		if err != nil {
-			log.Printf("Error updating home team: %v", err)
-			return nil, err
-		}
+			// Update team stats
+			log.Printf("Updating team stats for %s and %s", homeTeam.Name, awayTeam.Name)
+			err := ApplyTeamChange(ctx, s.TeamRepo, homeTeam, func(team *models.Team) {
+				addTeamResult(team, match.HomeTeamGoals, match.AwayTeamGoals)
+			})
+			if err != nil {
+				log.Printf("Error updating home team: %v", err)
+				return err
+			}
 
-		err = s.TeamRepo.Update(awayTeam)
+			err = ApplyTeamChange(ctx, s.TeamRepo, awayTeam, func(team *models.Team) {
+				addTeamResult(team, match.AwayTeamGoals, match.HomeTeamGoals)
+			})
+			if err != nil {
+				log.Printf("Error updating away team: %v", err)
+			}
+			return err
+		})
 		if err != nil {
-			log.Printf("Error updating away team: %v", err)
 			return nil, err
 		}
+		metrics.MatchesSimulated.Inc()
 
 		playedMatches = append(playedMatches, match)
 	}
 
 	// Update current week
-	currentWeek, err := s.LeagueRepo.GetCurrentWeek()
+	currentWeek, err := s.LeagueRepo.GetCurrentWeek(ctx)
 	if err != nil {
 		log.Printf("Error getting current week: %v", err)
 		return nil, err
@@ -129,24 +172,18 @@ func (s *MatchSimulator) SimulateWeek(week int) ([]*models.Match, error) {
 	log.Printf("Current league week: %d, simulated week: %d", currentWeek, week)
 	
 	if currentWeek == week {
-		totalWeeks, err := s.LeagueRepo.GetTotalWeeks()
-		if err != nil {
-			log.Printf("Error getting total weeks: %v", err)
-			return nil, err
-		}
-
 		log.Printf("Total league weeks: %d", totalWeeks)
 		
 		if currentWeek < totalWeeks {
 			log.Printf("Advancing to week %d", currentWeek + 1)
-			err = s.LeagueRepo.UpdateWeek(currentWeek + 1)
+			err = s.LeagueRepo.UpdateWeek(ctx, currentWeek + 1)
 			if err != nil {
 				log.Printf("Error updating league week: %v", err)
 				return nil, err
 			}
 		} else {
 			log.Printf("Marking league as completed")
-			err = s.LeagueRepo.MarkAsCompleted()
+			err = s.LeagueRepo.MarkAsCompleted(ctx)
 			if err != nil {
 				log.Printf("Error marking league as completed: %v", err)
 				return nil, err
@@ -159,8 +196,8 @@ func (s *MatchSimulator) SimulateWeek(week int) ([]*models.Match, error) {
 }
 
 // SimulateRemaining simulates all remaining matches in the league
-func (s *MatchSimulator) SimulateRemaining() ([]*models.Match, error) {
-	unplayedMatches, err := s.MatchRepo.GetUnplayed()
+func (s *MatchSimulator) SimulateRemaining(ctx context.Context) ([]*models.Match, error) {
+	unplayedMatches, err := s.MatchRepo.GetUnplayed(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -172,13 +209,13 @@ func (s *MatchSimulator) SimulateRemaining() ([]*models.Match, error) {
 	}
 
 	// Get current week
-	currentWeek, err := s.LeagueRepo.GetCurrentWeek()
+	currentWeek, err := s.LeagueRepo.GetCurrentWeek(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get total weeks
-	totalWeeks, err := s.LeagueRepo.GetTotalWeeks()
+	totalWeeks, err := s.LeagueRepo.GetTotalWeeks(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -187,7 +224,7 @@ func (s *MatchSimulator) SimulateRemaining() ([]*models.Match, error) {
 	allPlayedMatches := make([]*models.Match, 0)
 	for week := currentWeek; week <= totalWeeks; week++ {
 		if _, ok := matchesByWeek[week]; ok {
-			playedMatches, err := s.SimulateWeek(week)
+			playedMatches, err := s.SimulateWeek(ctx, week)
 			if err != nil {
 				return nil, err
 			}
@@ -198,21 +235,66 @@ func (s *MatchSimulator) SimulateRemaining() ([]*models.Match, error) {
 	return allPlayedMatches, nil
 }
 
+// ScoreMatrix returns the exact scoreline probabilities of a match between two teams,
+// indexed by home goals and then away goals
+func (s *MatchSimulator) ScoreMatrix(homeTeam, awayTeam *models.Team) [][]float64 {
+	homeDist := goalDistribution(homeTeam, awayTeam, s.HomeAdvantage)
+	awayDist := goalDistribution(awayTeam, homeTeam, 0)
+
+	matrix := make([][]float64, len(homeDist))
+	for h := range homeDist {
+		matrix[h] = make([]float64, len(awayDist))
+		for a := range awayDist {
+			matrix[h][a] = homeDist[h] * awayDist[a]
+		}
+	}
+
+	return matrix
+}
+
 // Helper functions
-func simulateGoals(teamStrength int, isHome bool) int {
-	// Home advantage factor
-	homeFactor := 0
-	if isHome {
-		homeFactor = 1
+
+// simulateMatchWithRand plays a match with rng when the simulator supports per-caller random sources
+func simulateMatchWithRand(simulator Simulator, homeTeam, awayTeam *models.Team, rng *rand.Rand) (*models.Match, error) {
+	if seeded, ok := simulator.(SeededSimulator); ok && rng != nil {
+		return seeded.SimulateMatchWithRand(homeTeam, awayTeam, rng)
 	}
+	return simulator.SimulateMatch(homeTeam, awayTeam)
+}
+
+// maxSimulatedGoals is the number of scoring chances each team gets in a simulated match
+const maxSimulatedGoals = 5
 
+// goalProbability returns the chance of a team converting each scoring chance against opponent.
+// homeAdvantage is added for the home team and is zero for the away team.
+func goalProbability(team, opponent *models.Team, homeAdvantage float64) float64 {
 	// Base goal probability adjusted by team strength
-	baseProb := float64(teamStrength) / 10.0
+	baseProb := float64(team.Strength) / 10.0
+
+	return (baseProb + homeAdvantage) * matchupFactor(team, opponent)
+}
+
+// matchupFactor scales a team's scoring chances by its attack against the opponent's defence, as the
+// Dixon-Coles ratings do. It is 1 at the default ratings; the square root keeps it from doubling up
+// with Strength, which calibration already derives from the same ratings.
+func matchupFactor(team, opponent *models.Team) float64 {
+	attack, defence := team.Attack, opponent.Defence
+	if attack <= 0 {
+		attack = 1
+	}
+	if defence <= 0 {
+		defence = 1
+	}
+	return math.Sqrt(attack / defence)
+}
+
+func simulateGoals(team, opponent *models.Team, homeAdvantage float64, random func() float64) int {
+	prob := goalProbability(team, opponent, homeAdvantage)
 
 	// Generate a random number of goals with more weight to stronger teams
 	goals := 0
-	for i := 0; i < 5; i++ { // Max 5 goals
-		if rand.Float64() < (baseProb + float64(homeFactor)*0.1) {
+	for i := 0; i < maxSimulatedGoals; i++ {
+		if random() < prob {
 			goals++
 		}
 	}
@@ -220,31 +302,48 @@ func simulateGoals(teamStrength int, isHome bool) int {
 	return goals
 }
 
+// goalDistribution returns the probability of each goal count produced by simulateGoals
+func goalDistribution(team, opponent *models.Team, homeAdvantage float64) []float64 {
+	prob := math.Max(0, math.Min(1, goalProbability(team, opponent, homeAdvantage)))
+
+	dist := make([]float64, maxSimulatedGoals+1)
+	for k := range dist {
+		dist[k] = binomialCoefficient(maxSimulatedGoals, k) * math.Pow(prob, float64(k)) * math.Pow(1-prob, float64(maxSimulatedGoals-k))
+	}
+
+	return dist
+}
+
+// binomialCoefficient returns the number of ways to choose k items from n
+func binomialCoefficient(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
 // updateTeamStats updates the statistics for both teams after a match
 func updateTeamStats(homeTeam, awayTeam *models.Team, match *models.Match) {
-	// Update home team stats
-	homeTeam.Played++
-	homeTeam.GoalsFor += match.HomeTeamGoals
-	homeTeam.GoalsAgainst += match.AwayTeamGoals
+	addTeamResult(homeTeam, match.HomeTeamGoals, match.AwayTeamGoals)
+	addTeamResult(awayTeam, match.AwayTeamGoals, match.HomeTeamGoals)
+}
 
-	// Update away team stats
-	awayTeam.Played++
-	awayTeam.GoalsFor += match.AwayTeamGoals
-	awayTeam.GoalsAgainst += match.HomeTeamGoals
+// addTeamResult adds a match result to a team's statistics
+func addTeamResult(team *models.Team, goalsFor, goalsAgainst int) {
+	team.Played++
+	team.GoalsFor += goalsFor
+	team.GoalsAgainst += goalsAgainst
 
 	// Update wins, draws, losses
-	if match.HomeTeamGoals > match.AwayTeamGoals {
-		homeTeam.Won++
-		awayTeam.Lost++
-	} else if match.HomeTeamGoals < match.AwayTeamGoals {
-		homeTeam.Lost++
-		awayTeam.Won++
+	if goalsFor > goalsAgainst {
+		team.Won++
+	} else if goalsFor < goalsAgainst {
+		team.Lost++
 	} else {
-		homeTeam.Drawn++
-		awayTeam.Drawn++
+		team.Drawn++
 	}
 
 	// Update points and goal difference
-	homeTeam.UpdateStats()
-	awayTeam.UpdateStats()
+	team.UpdateStats()
 } 
\ No newline at end of file
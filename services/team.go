@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/user/footballsim/models"
+)
+
+// Team errors
+var (
+	ErrTeamNotFound      = errors.New("team not found")
+	ErrDuplicateTeamName = models.ErrDuplicateTeamName
+	ErrSameTeam          = errors.New("the teams must be different")
+)
+
+// TeamService creates and updates teams from validated requests and reports on their matches
+type TeamService struct {
+	TeamRepo  TeamRepository
+	MatchRepo MatchRepository
+	Odds      *OddsCalculator
+	Lock      LeagueLock
+}
+
+// NewTeamService creates a new team service
+func NewTeamService(teamRepo TeamRepository, matchRepo MatchRepository, odds *OddsCalculator, lock LeagueLock) *TeamService {
+	return &TeamService{
+		TeamRepo:  teamRepo,
+		MatchRepo: matchRepo,
+		Odds:      odds,
+		Lock:      lock,
+	}
+}
+
+// Create adds a team with empty standings. The request must have been validated.
+// It takes the league lock, like every other write to the league.
+func (s *TeamService) Create(ctx context.Context, request *models.TeamRequest) (*models.Team, error) {
+	unlock, err := s.Lock.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := s.checkName(ctx, request.Name, 0); err != nil {
+		return nil, err
+	}
+
+	// Ratings start at the league average until they are given or calibrated
+	team := &models.Team{Attack: 1, Defence: 1}
+	request.Apply(team)
+	if err := s.TeamRepo.Create(ctx, team); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// Update changes a team's name and ratings, keeping its standings. The request must have been validated.
+// A non-zero version must match the team's current version. It takes the league lock, like Create.
+func (s *TeamService) Update(ctx context.Context, id int, request *models.TeamRequest, version int) (*models.Team, error) {
+	unlock, err := s.Lock.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	team, err := s.team(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && version != team.Version {
+		return nil, fmt.Errorf("%w: team %d is at version %d", models.ErrVersionConflict, id, team.Version)
+	}
+
+	if err := s.checkName(ctx, request.Name, id); err != nil {
+		return nil, err
+	}
+
+	request.Apply(team)
+	if err := s.TeamRepo.Update(ctx, team); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// Matches returns a team's results with its running points total, its upcoming fixtures
+// and a summary with its form over the last formMatches results
+func (s *TeamService) Matches(ctx context.Context, id, formMatches int) (*models.TeamMatches, error) {
+	team, err := s.team(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := findAllMatches(ctx, s.MatchRepo, &models.MatchFilter{TeamID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	teamMatches := &models.TeamMatches{
+		TeamID:   team.ID,
+		TeamName: team.Name,
+		Results:  make([]*models.TeamResult, 0),
+		Fixtures: make([]*models.TeamFixture, 0),
+	}
+	totalPoints := 0
+	for _, match := range matches {
+		if !match.Played {
+			teamMatches.Fixtures = append(teamMatches.Fixtures, match.FixtureFor(id))
+			continue
+		}
+		result := match.ResultFor(id)
+		totalPoints += result.Points
+		runningTotal := totalPoints
+		result.TotalPoints = &runningTotal
+		teamMatches.Results = append(teamMatches.Results, result)
+	}
+	teamMatches.Summary = summarizeResults(teamMatches.Results, formMatches)
+
+	return teamMatches, nil
+}
+
+// HeadToHead returns the record of the played meetings between two teams, their last
+// recentMatches results and the outcome probabilities of their next meeting
+func (s *TeamService) HeadToHead(ctx context.Context, id, otherID, recentMatches int) (*models.HeadToHead, error) {
+	if id == otherID {
+		return nil, fmt.Errorf("%w: a team does not play itself", ErrSameTeam)
+	}
+
+	team, err := s.team(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	opponent, err := s.team(ctx, otherID)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := findAllMatches(ctx, s.MatchRepo, &models.MatchFilter{TeamID: id, OpponentID: otherID})
+	if err != nil {
+		return nil, err
+	}
+
+	headToHead := &models.HeadToHead{
+		TeamID:        team.ID,
+		TeamName:      team.Name,
+		OpponentID:    opponent.ID,
+		OpponentName:  opponent.Name,
+		RecentResults: make([]*models.TeamResult, 0),
+	}
+	var nextMeeting *models.Match
+	for _, match := range matches {
+		if !match.Played {
+			if nextMeeting == nil {
+				nextMeeting = match
+			}
+			continue
+		}
+		headToHead.Add(match.ResultFor(id))
+	}
+
+	// Results are in week order, so the most recent are at the end
+	for i := len(matches) - 1; i >= 0 && len(headToHead.RecentResults) < recentMatches; i-- {
+		if matches[i].Played {
+			headToHead.RecentResults = append(headToHead.RecentResults, matches[i].ResultFor(id))
+		}
+	}
+
+	// Without a scheduled meeting, the next one is taken to be at the first team's ground
+	if nextMeeting != nil {
+		headToHead.NextMeeting, err = s.Odds.MatchOdds(ctx, nextMeeting)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		headToHead.NextMeeting = s.Odds.FixtureOdds(team, opponent)
+	}
+
+	return headToHead, nil
+}
+
+// team returns a team, or ErrTeamNotFound
+func (s *TeamService) team(ctx context.Context, id int) (*models.Team, error) {
+	team, err := s.TeamRepo.GetByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrTeamNotFound, id)
+	}
+	return team, err
+}
+
+// maxVersionRetries is the number of times a standings change is reapplied after concurrent updates
+const maxVersionRetries = 3
+
+// ApplyTeamChange applies a change to a team's standings and saves it. When someone else updated the
+// team since it was read, the team is read again and the change reapplied, so no update is lost.
+func ApplyTeamChange(ctx context.Context, teamRepo TeamRepository, team *models.Team, change func(team *models.Team)) error {
+	for attempt := 0; ; attempt++ {
+		change(team)
+		err := teamRepo.Update(ctx, team)
+		if !errors.Is(err, models.ErrVersionConflict) || attempt == maxVersionRetries {
+			return err
+		}
+
+		latest, err := teamRepo.GetByID(ctx, team.ID)
+		if err != nil {
+			return err
+		}
+		*team = *latest
+	}
+}
+
+// findAllMatches returns every match selected by a filter in week order, reading all pages
+func findAllMatches(ctx context.Context, matchRepo MatchRepository, filter *models.MatchFilter) ([]*models.Match, error) {
+	filter.Sort, filter.Page, filter.PageSize = models.MatchSortWeek, 1, models.MaxMatchPageSize
+
+	var matches []*models.Match
+	for {
+		page, total, err := matchRepo.Find(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, page...)
+		if len(page) == 0 || len(matches) >= total {
+			return matches, nil
+		}
+		filter.Page++
+	}
+}
+
+// summarizeResults returns the form, home and away records and longest streaks of results in playing order
+func summarizeResults(results []*models.TeamResult, formMatches int) models.TeamMatchSummary {
+	var summary models.TeamMatchSummary
+	var wins, unbeaten, losses int
+	for i, result := range results {
+		summary.Overall.Add(result)
+		if result.Venue == models.VenueHome {
+			summary.Home.Add(result)
+		} else {
+			summary.Away.Add(result)
+		}
+
+		if i >= len(results)-formMatches {
+			summary.Form += result.Result
+			summary.FormPoints += result.Points
+		}
+
+		switch result.Result {
+		case models.ResultWin:
+			wins, unbeaten, losses = wins+1, unbeaten+1, 0
+		case models.ResultDraw:
+			wins, unbeaten, losses = 0, unbeaten+1, 0
+		default:
+			wins, unbeaten, losses = 0, 0, losses+1
+		}
+		if wins > summary.LongestWinStreak {
+			summary.LongestWinStreak = wins
+		}
+		if unbeaten > summary.LongestUnbeatenStreak {
+			summary.LongestUnbeatenStreak = unbeaten
+		}
+		if losses > summary.LongestLosingStreak {
+			summary.LongestLosingStreak = losses
+		}
+	}
+	return summary
+}
+
+// checkName returns ErrDuplicateTeamName if a team other than id already has the name, ignoring case.
+// It gives a clear error early; the unique index on the teams table settles concurrent requests.
+func (s *TeamService) checkName(ctx context.Context, name string, id int) error {
+	teams, err := s.TeamRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, team := range teams {
+		if team.ID != id && strings.EqualFold(team.Name, name) {
+			return fmt.Errorf("%w: a team called %q already exists", ErrDuplicateTeamName, team.Name)
+		}
+	}
+	return nil
+}
@@ -18,6 +18,38 @@ let currentLeague = null;
 let currentWeek = 0;
 let totalWeeks = 18;
 
+// API key used for requests that change data, kept in local storage
+const API_KEY_STORAGE_KEY = 'footballsim_api_key';
+
+// Fetch wrapper for write requests: sends the stored API key and asks for one when the server refuses it
+async function authorizedFetch(url, options = {}) {
+    const usedKey = localStorage.getItem(API_KEY_STORAGE_KEY) || '';
+    const withKey = key => ({
+        ...options,
+        headers: { ...(options.headers || {}), 'X-API-Key': key }
+    });
+
+    let response = await fetch(url, withKey(usedKey));
+    if (response.status !== 401 && response.status !== 403) {
+        return response;
+    }
+
+    // Another request may already have asked for a new key
+    let key = localStorage.getItem(API_KEY_STORAGE_KEY) || '';
+    if (key === usedKey) {
+        key = window.prompt(response.status === 401
+            ? 'This action needs an API key. Please enter your key:'
+            : 'Your API key does not allow this action. Please enter a key with more rights:');
+        if (!key) {
+            return response;
+        }
+        localStorage.setItem(API_KEY_STORAGE_KEY, key);
+    }
+
+    response = await fetch(url, withKey(key));
+    return response;
+}
+
 // Initialize the application
 document.addEventListener('DOMContentLoaded', () => {
     console.log('App initialized, connecting to API at:', API_BASE_URL);
@@ -343,7 +375,7 @@ async function handleSaveAllScores() {
             
             // Add update request to promises array
             updatePromises.push(
-                fetch(`${API_BASE_URL}/matches/${matchId}`, {
+                authorizedFetch(`${API_BASE_URL}/matches/${matchId}`, {
                     method: 'PUT',
                     headers: {
                         'Content-Type': 'application/json'
@@ -427,7 +459,11 @@ async function loadPrediction() {
         const response = await fetch(`${API_BASE_URL}/league/prediction`);
         if (!response.ok) {
             console.error('Prediction response not OK:', response.status, response.statusText);
-            predictions.innerHTML = '<div class="error-message">Predictions are only available after week 4.</div>';
+            const errorData = await response.json().catch(() => ({}));
+            const errorMessage = document.createElement('div');
+            errorMessage.className = 'error-message';
+            errorMessage.textContent = errorData.detail || 'Predictions are not available yet.';
+            predictions.appendChild(errorMessage);
             return;
         }
         
@@ -498,7 +534,7 @@ async function handlePlayAll() {
         playAllButton.disabled = true;
         nextWeekButton.disabled = true;
         
-        const response = await fetch(`${API_BASE_URL}/matches/simulate-all`, {
+        const response = await authorizedFetch(`${API_BASE_URL}/matches/simulate-all`, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json'
@@ -532,7 +568,7 @@ async function handleNextWeek() {
             playAllButton.disabled = true;
             nextWeekButton.disabled = true;
             
-            const response = await fetch(`${API_BASE_URL}/matches/week/${currentWeek}/simulate`, {
+            const response = await authorizedFetch(`${API_BASE_URL}/matches/week/${currentWeek}/simulate`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json'
@@ -630,7 +666,7 @@ async function handleResetLeague() {
         nextWeekButton.disabled = true;
         resetLeagueButton.disabled = true;
         
-        const response = await fetch(`${API_BASE_URL}/league/reset`, {
+        const response = await authorizedFetch(`${API_BASE_URL}/league/reset`, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json'